@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
 	"os/signal"
 	"syscall"
 
@@ -16,9 +17,10 @@ var (
 )
 
 func main() {
-	fmt.Printf("Build version: %s\n", buildVersion)
-	fmt.Printf("Build date: %s\n", buildDate)
-	fmt.Printf("Build commit: %s\n", buildCommit)
+	// стандартный вывод занимают метрики при выводе в stdout
+	fmt.Fprintf(os.Stderr, "Build version: %s\n", buildVersion)
+	fmt.Fprintf(os.Stderr, "Build date: %s\n", buildDate)
+	fmt.Fprintf(os.Stderr, "Build commit: %s\n", buildCommit)
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	defer stop()
@@ -38,6 +38,22 @@ const docTemplate = `{
                 }
             }
         },
+        "/healthz": {
+            "get": {
+                "tags": [
+                    "Info"
+                ],
+                "summary": "Запрос доступности сервера",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/ping": {
             "get": {
                 "tags": [
@@ -153,6 +169,12 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "403": {
+                        "description": "Неверная подпись агента",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {
@@ -1,5 +1,5 @@
 // Package agent - клиентская часть приложения по сбору метрик.
-// собирает фиксированный список метрик и отправляет на сервер
+// собирает метрики из зарегистрированных источников collector.Collector и отправляет на сервер
 // Интервалы сбора метрик и отправки настраиваются.
 // Данные отправляются в формате JSON в пакетном режиме, применяется Gzip сжатие.
 // В приложении доступен профилировщик
@@ -12,8 +12,14 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
+	"regexp"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/atrian/devmetrics/internal/agent/collector"
+	"github.com/atrian/devmetrics/internal/agent/outbox"
 	"github.com/atrian/devmetrics/internal/appconfig/agentconfig"
 	"github.com/atrian/devmetrics/pkg/logger"
 )
@@ -27,45 +33,80 @@ type (
 
 // Agent - основное приложение агента сборщика
 type Agent struct {
-	// config конфигурация агента сбора метрик: интервалы опроса и отправки, адрес сервера, ключ для подписи метрик
+	// config конфигурация агента сбора метрик: интервалы опроса и отправки, адрес сервера, ключ для подписи метрик.
+	// Заменяется при перезагрузке конфигурации, после запуска читается через currentConfig
 	config *agentconfig.Config
 	// metrics in memory хранилище для собираемых метрик
 	metrics *MetricsDics
-	// uploader для загрузки метрик на сервер
-	uploader *Uploader
+	// collectors реестр источников метрик
+	collectors *collector.Registry
+	// telemetry метрики работы агента, nil - не собираются
+	telemetry *telemetry
+	// destinations серверы для отправки метрик, у каждого своя очередь и воркеры. Заменяются при перезагрузке конфигурации
+	destinations []*destination
+	// reloaded закрывается после каждой перезагрузки конфигурации и заменяется новым каналом
+	reloaded chan struct{}
+	// mu защищает config, destinations и reloaded
+	mu sync.RWMutex
 	// logger интерфейс логгера, в приложении используется ZAP логгер
 	logger logger.Logger
 	// profiler сервер профилировщика
 	profiler http.Server
 }
 
-// Run запуск основных функций: сбор статистики и отправка на сервер с определенным интервалом
+// Run запуск основных функций: сбор статистики и отправка на сервер с определенным интервалом.
+// По сигналу SIGHUP конфигурация перечитывается без перезапуска агента.
+// В режиме Once метрики собираются и отправляются однократно, после чего агент завершается
 func (a *Agent) Run(ctx context.Context) {
+	if a.config.Agent.Once {
+		if err := a.RunOnce(ctx); err != nil {
+			a.logger.Fatal("One-shot run failed", err)
+		}
+		a.logger.Info("One-shot run finished")
+		return
+	}
+
 	graceShutdown := make(chan struct{})
 
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+
 	a.logger.Info(
-		fmt.Sprintf("Agent started. PollInterval: %v, ReportInterval: %v, Server address: %v",
+		fmt.Sprintf("Agent started. PollInterval: %v, ReportInterval: %v, Destinations: %v",
 			a.config.Agent.PollInterval,
 			a.config.Agent.ReportInterval,
-			a.config.Transport.AddressHTTP))
+			len(a.destinations)))
 
-	// запускаем тикер сбора статистики
-	refreshStatsTicker := time.NewTicker(a.config.Agent.PollInterval)
+	// запускаем опрос всех зарегистрированных источников метрик, каждый со своим интервалом
+	for _, c := range a.collectors.Collectors() {
+		if runner, ok := c.(collector.Runner); ok {
+			go a.runBackground(ctx, c.Name(), runner)
+		}
+		go a.runCollector(ctx, c)
+	}
+
+	// запускаем воркеры отправки, не больше RateLimit одновременных отправок на каждый сервер
+	for _, d := range a.destinations {
+		d.run(ctx, a.config.Agent.RateLimit, a.config.Agent.HealthCheckInterval, a.logger)
+	}
 
 	// запускаем тикер отправки статистики
 	uploadStatsTicker := time.NewTicker(a.config.Agent.ReportInterval)
 
-	// получаем сигнал из тикеров и запускаем методы сбора и отправки
+	// получаем сигнал из тикера и запускаем отправку
 	go func() {
 		for {
 			select {
-			case refreshTime := <-refreshStatsTicker.C:
-				a.logger.Debug(fmt.Sprintf("Metrics refresh. Time: %v", refreshTime))
-				go a.RefreshRuntimeStats()
-				go a.RefreshGopsStats()
 			case uploadTime := <-uploadStatsTicker.C:
 				a.logger.Debug(fmt.Sprintf("Metrics upload. Time: %v", uploadTime))
-				go a.UploadStats()
+				a.UploadStats(ctx)
+			case <-reload:
+				if err := a.Reload(ctx); err != nil {
+					a.logger.Error("Configuration reload failed, keep current configuration", err)
+					continue
+				}
+				uploadStatsTicker.Reset(a.currentConfig().Agent.ReportInterval)
 			case <-ctx.Done():
 				// при завершении контекста выполняем последнюю отправку метрик
 				// закрываем сервер профилировщика, дожидаемся завершения операции и выходим из приложения
@@ -85,6 +126,56 @@ func (a *Agent) Run(ctx context.Context) {
 	<-graceShutdown
 }
 
+// RunOnce однократный сбор и отправка метрик без фоновых процессов.
+// Источники опрашиваются дважды с интервалом PollInterval, чтобы метрики, вычисляемые по разнице
+// между опросами, например загрузка CPU, получили значения. Источники с фоновой работой (StatsD, push)
+// в этом режиме не принимают метрики. Пакет отправляется на все серверы, соединения закрываются.
+// Возвращает ошибку, если пакет не отправлен хотя бы на один сервер
+func (a *Agent) RunOnce(ctx context.Context) error {
+	collectors := a.collectors.Collectors()
+	for _, c := range collectors {
+		a.RefreshStats(ctx, c)
+	}
+
+	select {
+	case <-time.After(a.config.Agent.PollInterval):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for _, c := range collectors {
+		a.RefreshStats(ctx, c)
+	}
+	a.collectors.Close()
+
+	batch := outbox.Batch{CollectedAt: time.Now(), Metrics: *a.metrics.exportMetrics(nil)}
+
+	errs := make([]error, len(a.destinations))
+	var wg sync.WaitGroup
+	for i, d := range a.destinations {
+		wg.Add(1)
+		go func(i int, d *destination) {
+			defer wg.Done()
+			errs[i] = d.uploader.SendBatch(batch)
+			if err := d.uploader.Close(); err != nil {
+				a.logger.Error("Can't close destination", err)
+			}
+		}(i, d)
+	}
+	wg.Wait()
+
+	var failed []error
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Errorf("destination %v: %w", a.destinations[i].uploader.Name(), err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("upload failed: %v", failed)
+	}
+	return nil
+}
+
 // NewAgent подготовка зависимостей пакета: логгер, конфигурация, временное хранилище метрик
 func NewAgent() *Agent {
 	// подключаем логгер
@@ -93,14 +184,25 @@ func NewAgent() *Agent {
 
 	config := agentconfig.NewConfig(agentLogger)
 
+	metrics := NewMetricsDicts(agentLogger, config.Agent.Aggregations, config.Agent.Relabel)
 	agent := &Agent{
-		config:   config,
-		metrics:  NewMetricsDicts(agentLogger),
-		uploader: NewUploader(config, agentLogger),
-		logger:   agentLogger,
+		config:     config,
+		metrics:    metrics,
+		collectors: collector.NewRegistry(),
+		telemetry:  newTelemetry(metrics),
+		reloaded:   make(chan struct{}),
+		logger:     agentLogger,
+	}
+
+	destinations, err := agent.newDestinations(config)
+	if err != nil {
+		agentLogger.Fatal("Can't prepare destinations", err)
 	}
+	agent.destinations = destinations
 
-	err := agent.RefreshAgentIp()
+	agent.registerCollectors()
+
+	err = agent.RefreshAgentIp()
 	if err != nil {
 		agent.logger.Error("Can't get agent IP address", err)
 	}
@@ -124,50 +226,210 @@ func (a *Agent) RunProfiler() {
 	}
 }
 
-// RefreshRuntimeStats обновление метрик из пакета runtime (runtime.MemStats)
-func (a *Agent) RefreshRuntimeStats() {
-	a.metrics.updateRuntimeMetrics()
+// registerCollectors регистрация встроенных источников метрик
+func (a *Agent) registerCollectors() {
+	builtin := []collector.Collector{
+		collector.NewPollCollector(a.config.Agent.PollInterval),
+		collector.NewRuntimeMetricsCollector(a.config.Agent.PollInterval),
+		collector.NewMemoryCollector(a.config.Agent.PollInterval),
+		collector.NewCPUCollector(a.config.Agent.PollInterval),
+		collector.NewHostCollector(a.config.Agent.PollInterval),
+		collector.NewDiskCollector(a.config.Agent.PollInterval, collector.Filter{
+			Include: a.config.Agent.Disk.MountpointsInclude,
+			Exclude: a.config.Agent.Disk.MountpointsExclude,
+		}),
+		collector.NewNetworkCollector(a.config.Agent.PollInterval, collector.Filter{
+			Include: a.config.Agent.Network.InterfacesInclude,
+			Exclude: a.config.Agent.Network.InterfacesExclude,
+		}),
+	}
+
+	// метрики runtime.MemStats требуют остановки мира, их можно отключить
+	if a.config.Agent.MemStats {
+		builtin = append(builtin, collector.NewRuntimeCollector(a.config.Agent.PollInterval))
+	}
+
+	// метрики контейнера собираются только внутри контейнера со смонтированной cgroup
+	if _, err := os.Stat(a.config.Agent.CgroupRoot); err == nil && collector.InContainer("/") {
+		builtin = append(builtin, collector.NewCgroupCollector(a.config.Agent.PollInterval, a.config.Agent.CgroupRoot))
+	}
+
+	// процессы отслеживаются только если они перечислены в конфигурации
+	if len(a.config.Agent.Processes) > 0 {
+		builtin = append(builtin, collector.NewProcessCollector(a.config.Agent.PollInterval, a.processTargets()))
+	}
+
+	// StatsD метрики агрегируются за окно отправки
+	if a.config.Agent.StatsDAddress != "" {
+		builtin = append(builtin, collector.NewStatsDCollector(a.config.Agent.StatsDAddress, a.config.Agent.ReportInterval))
+	}
 
-	a.logger.Info(fmt.Sprintf("Runtime stats updated. PollCount: %v",
-		int64(a.metrics.CounterDict["PollCount"].value)))
+	// локальный эндпоинт для приложений на том же хосте
+	if a.config.Agent.PushAddress != "" {
+		builtin = append(builtin, collector.NewPushCollector(a.config.Agent.PushAddress, a.config.Agent.PollInterval))
+	}
+
+	if len(a.config.Agent.PrometheusTargets) > 0 {
+		builtin = append(builtin, collector.NewPrometheusCollector(a.config.Agent.PollInterval, a.config.Agent.PrometheusTargets))
+	}
+
+	// у каждой внешней команды свой интервал, поэтому для каждой регистрируется отдельный источник
+	for _, e := range a.config.Agent.Exec {
+		interval := e.Interval
+		if interval <= 0 {
+			interval = a.config.Agent.PollInterval
+		}
+		builtin = append(builtin, collector.NewExecCollector(e.Name, e.Command, e.Args, interval, e.Timeout))
+	}
+
+	if len(a.config.Agent.LogTail.Files) > 0 {
+		builtin = append(builtin, collector.NewLogTailCollector(a.config.Agent.PollInterval, a.logFiles(), a.config.Agent.LogTail.OffsetsFile))
+	}
+
+	for _, c := range builtin {
+		if err := a.RegisterCollector(c); err != nil {
+			a.logger.Error("Can't register builtin collector", err)
+		}
+	}
+}
+
+// processTargets собирает описания отслеживаемых процессов из конфигурации
+func (a *Agent) processTargets() []collector.ProcessTarget {
+	targets := make([]collector.ProcessTarget, 0, len(a.config.Agent.Processes))
+
+	for _, p := range a.config.Agent.Processes {
+		target := collector.ProcessTarget{
+			Label:   p.Label,
+			PIDFile: p.PIDFile,
+			Name:    p.Name,
+		}
+		if p.Cmdline != "" {
+			// выражение проверено при загрузке конфигурации
+			target.Cmdline = regexp.MustCompile(p.Cmdline)
+		}
+		targets = append(targets, target)
+	}
+
+	return targets
+}
+
+// logFiles преобразует конфигурацию файлов логов. Правила с некорректным выражением или типом пропускаются
+func (a *Agent) logFiles() []collector.LogFile {
+	files := make([]collector.LogFile, 0, len(a.config.Agent.LogTail.Files))
+
+	for _, f := range a.config.Agent.LogTail.Files {
+		file := collector.LogFile{Path: f.Path, FromBeginning: f.FromBeginning}
+		for _, r := range f.Rules {
+			// правила проверены в agentconfig.Validate
+			re, err := r.Compile()
+			if err != nil {
+				a.logger.Error(fmt.Sprintf("Invalid log rule %v", r.Name), err)
+				continue
+			}
+			file.Rules = append(file.Rules, collector.LogRule{Name: r.Name, Regex: re, Type: r.Type, ValueGroup: r.Value})
+		}
+		files = append(files, file)
+	}
+
+	return files
+}
+
+// RegisterCollector добавляет источник метрик. Вызывать до Run
+func (a *Agent) RegisterCollector(c collector.Collector) error {
+	return a.collectors.Register(c)
+}
+
+// runCollector опрашивает источник метрик с его интервалом до завершения контекста.
+// Источники с интервалом PollInterval агента переходят на новый PollInterval при перезагрузке конфигурации
+func (a *Agent) runCollector(ctx context.Context, c collector.Collector) {
+	interval := c.Interval()
+	pollInterval := a.currentConfig().Agent.PollInterval
+	followsPoll := interval <= 0 || interval == pollInterval
+	if followsPoll {
+		interval = pollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case refreshTime := <-ticker.C:
+			a.logger.Debug(fmt.Sprintf("Collector %v refresh. Time: %v", c.Name(), refreshTime))
+			a.RefreshStats(ctx, c)
+		case <-a.reloadNotify():
+			if pollInterval = a.currentConfig().Agent.PollInterval; followsPoll && pollInterval != interval {
+				interval = pollInterval
+				ticker.Reset(interval)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runBackground запускает фоновую работу источника метрик, ошибки выводятся в лог
+func (a *Agent) runBackground(ctx context.Context, name string, runner collector.Runner) {
+	if err := runner.Run(ctx); err != nil {
+		a.logger.Error(fmt.Sprintf("Collector %v stopped", name), err)
+	}
 }
 
-// RefreshGopsStats обновление метрик из пакета mem (mem.VirtualMemoryStat)
-func (a *Agent) RefreshGopsStats() {
-	a.metrics.updateGopsMetrics()
+// RefreshStats обновление метрик из источника c. Время опроса и ошибки учитываются в метриках агента
+func (a *Agent) RefreshStats(ctx context.Context, c collector.Collector) {
+	started := time.Now()
+	metrics, err := c.Collect(ctx)
+	a.telemetry.collect(c.Name(), time.Since(started), err)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("Collector %v failed", c.Name()), err)
+	}
 
-	a.logger.Info(fmt.Sprintf("Gops stats updated. PollCount: %v",
-		int64(a.metrics.CounterDict["PollCount"].value)))
+	a.metrics.Store(metrics)
+
+	a.logger.Info(fmt.Sprintf("%v stats updated. Metrics: %v", c.Name(), len(metrics)))
 }
 
-// UploadStats отправка метрик на сервер
-func (a *Agent) UploadStats() {
-	a.uploader.SendAllStats(a.metrics)
-	a.logger.Info("Upload stats")
+// UploadStats выгружает метрики и ставит пакет в очередь отправки каждого сервера.
+// При переполнении очереди применяется политика OverflowPolicy, при политике block вызов ждет освобождения места
+// во всех очередях, но отправка на остальные серверы при этом продолжается
+func (a *Agent) UploadStats(ctx context.Context) {
+	batch := outbox.Batch{CollectedAt: time.Now(), Metrics: *a.metrics.exportMetrics(nil)}
+
+	// серверы не заменяются, пока пакет ставится в очереди
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, d := range a.destinations {
+		wg.Add(1)
+		go func(d *destination) {
+			defer wg.Done()
+			d.push(ctx, batch, a.logger)
+		}(d)
+	}
+	wg.Wait()
 }
 
 // Stop операции при завершении приложения
 func (a *Agent) Stop(grace chan struct{}) {
 	defer close(grace)
 
-	// Отправляем все текущие метрики
-	a.UploadStats()
+	// Отправляем все текущие метрики и дожидаемся отправки очередей всех серверов, соединения закрываются
+	a.UploadStats(context.Background())
+	a.mu.RLock()
+	stopDestinations(a.destinations, a.logger)
+	a.mu.RUnlock()
 	a.logger.Info("Last metrics sent")
 
+	// закрываем файлы и соединения источников метрик
+	a.collectors.Close()
+
 	// Завершаем сервер профилирования
 	if err := a.profiler.Shutdown(context.Background()); err != nil {
 		// ошибки закрытия Listener
 		a.logger.Error("Profiler server Shutdown err", err)
 	}
 
-	// закрываем GRPC соединение
-	if a.uploader.GRPCConnection != nil {
-		err := a.uploader.GRPCConnection.Close()
-		if err != nil {
-			a.logger.Error("Error on GRPC connection close", err)
-		}
-	}
-
 	a.logger.Info("Profiler closed")
 }
 
@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"path"
+	"sort"
+
+	"github.com/atrian/devmetrics/internal/agent/collector"
+	"github.com/atrian/devmetrics/internal/appconfig/agentconfig"
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+// gaugeWindow значения gauge метрики, собранные за окно отправки
+type gaugeWindow struct {
+	aggregates []string  // aggregates отправляемые агрегаты
+	samples    []float64 // samples значения для перцентилей, хранятся только если они запрошены
+	keep       bool      // keep хранить значения окна
+	min, max   float64
+	sum        float64
+	count      int64
+	total      int64 // total значений за все окна, выгружается как накопленный счетчик count
+}
+
+// newGaugeWindow возвращает окно агрегации gauge метрики id по первому подходящему правилу.
+// Если правила нет, метрика не агрегируется и возвращается nil
+func newGaugeWindow(id string, rules []agentconfig.AggregationConfig) *gaugeWindow {
+	for _, rule := range rules {
+		if matched, _ := path.Match(rule.Pattern, id); !matched {
+			continue
+		}
+
+		window := &gaugeWindow{aggregates: rule.Aggregates}
+		for _, aggregate := range rule.Aggregates {
+			if _, ok := percentileQuantiles[aggregate]; ok {
+				window.keep = true
+			}
+		}
+		return window
+	}
+
+	return nil
+}
+
+// percentileQuantiles квантили поддерживаемых перцентилей
+var percentileQuantiles = map[string]float64{
+	"p50": 0.5,
+	"p95": 0.95,
+	"p99": 0.99,
+}
+
+// add добавляет значение в окно
+func (w *gaugeWindow) add(value float64) {
+	if w.count == 0 || value < w.min {
+		w.min = value
+	}
+	if w.count == 0 || value > w.max {
+		w.max = value
+	}
+	w.sum += value
+	w.count++
+	w.total++
+
+	if w.keep {
+		w.samples = append(w.samples, value)
+	}
+}
+
+// export возвращает агрегаты окна как отдельные метрики <id>_<агрегат> и начинает новое окно.
+// Пустое окно агрегируется по последнему значению.
+// count выгружается как counter с накопленным за все окна значением, остальные агрегаты как gauge
+func (w *gaugeWindow) export(id string, last float64) []dto.Metrics {
+	min, max, avg, count := last, last, last, w.total
+	samples := w.samples
+	if w.count > 0 {
+		min, max, avg = w.min, w.max, w.sum/float64(w.count)
+	} else {
+		samples = []float64{last}
+	}
+	sort.Float64s(samples)
+
+	metrics := make([]dto.Metrics, 0, len(w.aggregates))
+	for _, aggregate := range w.aggregates {
+		var value float64
+		switch aggregate {
+		case "min":
+			value = min
+		case "max":
+			value = max
+		case "avg":
+			value = avg
+		case "last":
+			value = last
+		case "count":
+			metrics = append(metrics, dto.Metrics{ID: id + "_count", MType: "counter", Delta: &count})
+			continue
+		default:
+			quantile, ok := percentileQuantiles[aggregate]
+			if !ok {
+				continue
+			}
+			value = collector.NearestRank(samples, quantile)
+		}
+		metrics = append(metrics, dto.Metrics{ID: id + "_" + aggregate, MType: "gauge", Value: &value})
+	}
+
+	w.samples = nil
+	w.min, w.max, w.sum, w.count = 0, 0, 0, 0
+
+	return metrics
+}
@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atrian/devmetrics/internal/appconfig/agentconfig"
+	"github.com/atrian/devmetrics/internal/dto"
+	"github.com/atrian/devmetrics/pkg/logger"
+)
+
+func TestMetricsDics_Aggregation(t *testing.T) {
+	var rule agentconfig.AggregationConfig
+	require.NoError(t, rule.UnmarshalText([]byte("CPU*=min,max,avg,last,count,p50,p95")))
+
+	md := NewMetricsDicts(logger.NewZapLogger(), []agentconfig.AggregationConfig{rule}, nil)
+	for _, value := range []float64{10, 90, 20, 40} {
+		value := value
+		md.Store([]dto.Metrics{
+			{ID: "CPUutilization0", MType: "gauge", Value: &value},
+			{ID: "Alloc", MType: "gauge", Value: &value},
+		})
+	}
+
+	noSign := func(metricType, id string, delta *int64, value *float64) string { return "" }
+	exported := exportedByID(*md.exportMetrics(noSign))
+
+	assert.Equal(t, float64(40), *exported["Alloc"].Value)
+	assert.NotContains(t, exported, "CPUutilization0")
+	assert.Equal(t, float64(10), *exported["CPUutilization0_min"].Value)
+	assert.Equal(t, float64(90), *exported["CPUutilization0_max"].Value)
+	assert.Equal(t, float64(40), *exported["CPUutilization0_avg"].Value)
+	assert.Equal(t, float64(40), *exported["CPUutilization0_last"].Value)
+	assert.Equal(t, float64(20), *exported["CPUutilization0_p50"].Value)
+	assert.Equal(t, float64(90), *exported["CPUutilization0_p95"].Value)
+	assert.Equal(t, int64(4), *exported["CPUutilization0_count"].Delta)
+
+	// окно начинается заново, пустое окно агрегируется по последнему значению, count накапливается за все окна
+	exported = exportedByID(*md.exportMetrics(noSign))
+	assert.Equal(t, float64(40), *exported["CPUutilization0_max"].Value)
+	assert.Equal(t, int64(4), *exported["CPUutilization0_count"].Delta)
+}
+
+func TestAggregationConfig_UnmarshalText(t *testing.T) {
+	var rule agentconfig.AggregationConfig
+	assert.Error(t, rule.UnmarshalText([]byte("CPU*")))
+	assert.Error(t, rule.UnmarshalText([]byte("CPU*=median")))
+	assert.Error(t, rule.UnmarshalText([]byte("[=max")))
+}
+
+// exportedByID индексирует выгруженные метрики по имени
+func exportedByID(metrics []dto.Metrics) map[string]dto.Metrics {
+	byID := make(map[string]dto.Metrics, len(metrics))
+	for _, metric := range metrics {
+		byID[metric.ID] = metric
+	}
+	return byID
+}
@@ -0,0 +1,284 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+// cgroupUnlimited значение gauge лимита, если лимит не установлен
+const cgroupUnlimited = -1
+
+// cgroupV1UnlimitedThreshold в cgroup v1 отсутствие лимита памяти записывается огромным числом
+const cgroupV1UnlimitedThreshold = uint64(1) << 62
+
+// CgroupCollector метрики ресурсов контейнера из cgroup v1 или v2.
+// Версия определяется при каждом опросе по наличию файла cgroup.controllers в корне.
+// Отправляются gauge CgroupMemoryUsage, CgroupMemoryLimit, CgroupCPUQuota, CgroupCPUPeriod,
+// CgroupPidsCurrent, CgroupPidsMax (для лимитов -1 означает отсутствие ограничения)
+// и counter CgroupOOMEvents, CgroupCPUThrottledPeriods, CgroupCPUThrottledUsec.
+// Отсутствующие в cgroup контроллеры пропускаются
+type CgroupCollector struct {
+	interval time.Duration
+	root     string
+	counters *deltaTracker
+	mu       sync.Mutex
+}
+
+var _ Collector = (*CgroupCollector)(nil)
+
+// NewCgroupCollector возвращает источник метрик cgroup, смонтированной в root (обычно /sys/fs/cgroup)
+func NewCgroupCollector(interval time.Duration, root string) *CgroupCollector {
+	return &CgroupCollector{
+		interval: interval,
+		root:     root,
+		counters: newDeltaTracker(),
+	}
+}
+
+// Name имя источника
+func (c *CgroupCollector) Name() string {
+	return "cgroup"
+}
+
+// Interval интервал опроса источника
+func (c *CgroupCollector) Interval() time.Duration {
+	return c.interval
+}
+
+// Collect читает метрики ресурсов из файлов cgroup
+func (c *CgroupCollector) Collect(_ context.Context) ([]dto.Metrics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := os.Stat(c.root); err != nil {
+		return nil, fmt.Errorf("cgroup root: %w", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(c.root, "cgroup.controllers")); err == nil {
+		return c.collectV2()
+	}
+	return c.collectV1()
+}
+
+// collectV2 метрики единой иерархии cgroup v2
+func (c *CgroupCollector) collectV2() ([]dto.Metrics, error) {
+	var (
+		metrics []dto.Metrics
+		errs    []error
+	)
+	reader := cgroupReader{root: c.root, errs: &errs}
+
+	if usage, ok := reader.uint("memory.current"); ok {
+		metrics = append(metrics, Gauge("CgroupMemoryUsage", float64(usage)))
+	}
+	if limit, ok := reader.limit("memory.max"); ok {
+		metrics = append(metrics, Gauge("CgroupMemoryLimit", limit))
+	}
+	if events, ok := reader.keyValues("memory.events"); ok {
+		metrics = append(metrics, c.counter("CgroupOOMEvents", events["oom_kill"]))
+	}
+
+	if fields, ok := reader.fields("cpu.max"); ok && len(fields) == 2 {
+		quota := float64(cgroupUnlimited)
+		if fields[0] != "max" {
+			quota = parseFloatOrZero(fields[0])
+		}
+		metrics = append(metrics,
+			Gauge("CgroupCPUQuota", quota),
+			Gauge("CgroupCPUPeriod", parseFloatOrZero(fields[1])),
+		)
+	}
+	if stat, ok := reader.keyValues("cpu.stat"); ok {
+		metrics = append(metrics,
+			c.counter("CgroupCPUThrottledPeriods", stat["nr_throttled"]),
+			c.counter("CgroupCPUThrottledUsec", stat["throttled_usec"]),
+		)
+	}
+
+	if current, ok := reader.uint("pids.current"); ok {
+		metrics = append(metrics, Gauge("CgroupPidsCurrent", float64(current)))
+	}
+	if limit, ok := reader.limit("pids.max"); ok {
+		metrics = append(metrics, Gauge("CgroupPidsMax", limit))
+	}
+
+	return metrics, joinErrors(errs)
+}
+
+// collectV1 метрики раздельных иерархий контроллеров cgroup v1
+func (c *CgroupCollector) collectV1() ([]dto.Metrics, error) {
+	var (
+		metrics []dto.Metrics
+		errs    []error
+	)
+	reader := cgroupReader{root: c.root, errs: &errs}
+
+	if usage, ok := reader.uint("memory/memory.usage_in_bytes"); ok {
+		metrics = append(metrics, Gauge("CgroupMemoryUsage", float64(usage)))
+	}
+	if limit, ok := reader.uint("memory/memory.limit_in_bytes"); ok {
+		value := float64(limit)
+		if limit >= cgroupV1UnlimitedThreshold {
+			value = cgroupUnlimited
+		}
+		metrics = append(metrics, Gauge("CgroupMemoryLimit", value))
+	}
+	if oomControl, ok := reader.keyValues("memory/memory.oom_control"); ok {
+		metrics = append(metrics, c.counter("CgroupOOMEvents", oomControl["oom_kill"]))
+	}
+
+	if quota, ok := reader.fields("cpu/cpu.cfs_quota_us"); ok && len(quota) == 1 {
+		value := parseFloatOrZero(quota[0])
+		if value < 0 {
+			value = cgroupUnlimited
+		}
+		metrics = append(metrics, Gauge("CgroupCPUQuota", value))
+	}
+	if period, ok := reader.uint("cpu/cpu.cfs_period_us"); ok {
+		metrics = append(metrics, Gauge("CgroupCPUPeriod", float64(period)))
+	}
+	if stat, ok := reader.keyValues("cpu/cpu.stat"); ok {
+		metrics = append(metrics,
+			c.counter("CgroupCPUThrottledPeriods", stat["nr_throttled"]),
+			// в cgroup v1 время троттлинга в наносекундах
+			c.counter("CgroupCPUThrottledUsec", stat["throttled_time"]/1000),
+		)
+	}
+
+	if current, ok := reader.uint("pids/pids.current"); ok {
+		metrics = append(metrics, Gauge("CgroupPidsCurrent", float64(current)))
+	}
+	if limit, ok := reader.limit("pids/pids.max"); ok {
+		metrics = append(metrics, Gauge("CgroupPidsMax", limit))
+	}
+
+	return metrics, joinErrors(errs)
+}
+
+// containerMarkers файлы, которые среды исполнения контейнеров создают в корне файловой системы
+var containerMarkers = []string{".dockerenv", "run/.containerenv"}
+
+// InContainer сообщает, запущен ли процесс в контейнере. root - корень файловой системы, обычно "/".
+// Контейнер определяется по файлам /.dockerenv (Docker), /run/.containerenv (Podman)
+// и переменным окружения container (systemd-nspawn, LXC) и KUBERNETES_SERVICE_HOST (Kubernetes).
+// На обычном хосте cgroup тоже смонтирована, но описывает весь хост или сервис systemd, а не контейнер
+func InContainer(root string) bool {
+	for _, marker := range containerMarkers {
+		if _, err := os.Stat(filepath.Join(root, marker)); err == nil {
+			return true
+		}
+	}
+	return os.Getenv("container") != "" || os.Getenv("KUBERNETES_SERVICE_HOST") != ""
+}
+
+// counter возвращает приращение накопительного счетчика cgroup
+func (c *CgroupCollector) counter(id string, value uint64) dto.Metrics {
+	return Counter(id, c.counters.delta(id, value))
+}
+
+// cgroupReader читает файлы cgroup относительно root.
+// Отсутствующий файл означает отключенный контроллер и не считается ошибкой,
+// остальные ошибки чтения и разбора накапливаются в errs
+type cgroupReader struct {
+	root string
+	errs *[]error
+}
+
+// fields возвращает содержимое файла, разбитое по пробелам
+func (r cgroupReader) fields(name string) ([]string, bool) {
+	content, err := os.ReadFile(filepath.Join(r.root, name))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			*r.errs = append(*r.errs, err)
+		}
+		return nil, false
+	}
+	return strings.Fields(string(content)), true
+}
+
+// uint читает файл с одним целым числом
+func (r cgroupReader) uint(name string) (uint64, bool) {
+	fields, ok := r.fields(name)
+	if !ok {
+		return 0, false
+	}
+	return r.parseUint(name, fields)
+}
+
+// limit читает файл лимита cgroup v2, значение "max" означает отсутствие лимита
+func (r cgroupReader) limit(name string) (float64, bool) {
+	fields, ok := r.fields(name)
+	if !ok {
+		return 0, false
+	}
+	if len(fields) == 1 && fields[0] == "max" {
+		return cgroupUnlimited, true
+	}
+
+	value, ok := r.parseUint(name, fields)
+	return float64(value), ok
+}
+
+// parseUint разбирает содержимое файла name из одного целого числа
+func (r cgroupReader) parseUint(name string, fields []string) (uint64, bool) {
+	if len(fields) != 1 {
+		*r.errs = append(*r.errs, fmt.Errorf("cgroup %v: unexpected content", name))
+		return 0, false
+	}
+
+	value, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		*r.errs = append(*r.errs, fmt.Errorf("cgroup %v: %w", name, err))
+		return 0, false
+	}
+	return value, true
+}
+
+// keyValues читает файл формата "ключ значение" построчно (memory.events, cpu.stat)
+func (r cgroupReader) keyValues(name string) (map[string]uint64, bool) {
+	file, err := os.Open(filepath.Join(r.root, name))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			*r.errs = append(*r.errs, err)
+		}
+		return nil, false
+	}
+	defer file.Close()
+
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if value, pErr := strconv.ParseUint(fields[1], 10, 64); pErr == nil {
+			values[fields[0]] = value
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		*r.errs = append(*r.errs, fmt.Errorf("cgroup %v: %w", name, err))
+		return nil, false
+	}
+
+	return values, true
+}
+
+// parseFloatOrZero разбирает число, при ошибке возвращает 0
+func parseFloatOrZero(s string) float64 {
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
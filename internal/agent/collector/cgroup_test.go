@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCgroupFiles создает фейковую файловую систему cgroup
+func writeCgroupFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func TestCgroupCollector_CollectV2(t *testing.T) {
+	root := t.TempDir()
+	writeCgroupFiles(t, root, map[string]string{
+		"cgroup.controllers": "cpu memory pids\n",
+		"memory.current":     "104857600\n",
+		"memory.max":         "536870912\n",
+		"memory.events":      "low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n",
+		"cpu.max":            "50000 100000\n",
+		"cpu.stat":           "usage_usec 1000\nnr_periods 10\nnr_throttled 2\nthrottled_usec 300\n",
+		"pids.current":       "12\n",
+		"pids.max":           "max\n",
+	})
+
+	c := NewCgroupCollector(time.Second, root)
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, float64(104857600), gaugeValue(t, metrics, "CgroupMemoryUsage"))
+	assert.Equal(t, float64(536870912), gaugeValue(t, metrics, "CgroupMemoryLimit"))
+	assert.Equal(t, float64(50000), gaugeValue(t, metrics, "CgroupCPUQuota"))
+	assert.Equal(t, float64(100000), gaugeValue(t, metrics, "CgroupCPUPeriod"))
+	assert.Equal(t, float64(12), gaugeValue(t, metrics, "CgroupPidsCurrent"))
+	assert.Equal(t, float64(cgroupUnlimited), gaugeValue(t, metrics, "CgroupPidsMax"))
+
+	// счетчики растут между опросами
+	writeCgroupFiles(t, root, map[string]string{
+		"memory.events": "low 0\nhigh 0\nmax 3\noom 3\noom_kill 3\n",
+		"cpu.stat":      "usage_usec 2000\nnr_periods 20\nnr_throttled 5\nthrottled_usec 900\n",
+	})
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(2), counterValue(t, metrics, "CgroupOOMEvents"))
+	assert.Equal(t, int64(3), counterValue(t, metrics, "CgroupCPUThrottledPeriods"))
+	assert.Equal(t, int64(600), counterValue(t, metrics, "CgroupCPUThrottledUsec"))
+}
+
+func TestCgroupCollector_CollectV1(t *testing.T) {
+	root := t.TempDir()
+	writeCgroupFiles(t, root, map[string]string{
+		"memory/memory.usage_in_bytes": "2048\n",
+		"memory/memory.limit_in_bytes": "9223372036854771712\n",
+		"memory/memory.oom_control":    "oom_kill_disable 0\nunder_oom 0\noom_kill 0\n",
+		"cpu/cpu.cfs_quota_us":         "-1\n",
+		"cpu/cpu.cfs_period_us":        "100000\n",
+		"cpu/cpu.stat":                 "nr_periods 0\nnr_throttled 0\nthrottled_time 0\n",
+	})
+
+	metrics, err := NewCgroupCollector(time.Second, root).Collect(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, float64(2048), gaugeValue(t, metrics, "CgroupMemoryUsage"))
+	assert.Equal(t, float64(cgroupUnlimited), gaugeValue(t, metrics, "CgroupMemoryLimit"))
+	assert.Equal(t, float64(cgroupUnlimited), gaugeValue(t, metrics, "CgroupCPUQuota"))
+	assert.Equal(t, float64(100000), gaugeValue(t, metrics, "CgroupCPUPeriod"))
+	assert.Equal(t, int64(0), counterValue(t, metrics, "CgroupOOMEvents"))
+
+	// контроллер pids не смонтирован - метрик нет, ошибки нет
+	for _, metric := range metrics {
+		assert.NotContains(t, metric.ID, "Pids")
+	}
+}
+
+func TestCgroupCollector_MissingRoot(t *testing.T) {
+	_, err := NewCgroupCollector(time.Second, filepath.Join(t.TempDir(), "missing")).Collect(context.Background())
+	assert.Error(t, err)
+}
+
+func TestInContainer(t *testing.T) {
+	t.Setenv("container", "")
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+
+	// на хосте маркеров контейнера нет
+	root := t.TempDir()
+	assert.False(t, InContainer(root))
+
+	writeCgroupFiles(t, root, map[string]string{"run/.containerenv": ""})
+	assert.True(t, InContainer(root))
+
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.96.0.1")
+	assert.True(t, InContainer(t.TempDir()))
+}
@@ -0,0 +1,133 @@
+// Package collector источники метрик агента.
+// Каждый источник реализует интерфейс Collector и регистрируется в Registry,
+// агент опрашивает зарегистрированные источники каждый со своим интервалом
+package collector
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+// Collector источник метрик агента
+type Collector interface {
+	// Name уникальное имя источника, используется в логах и при регистрации
+	Name() string
+	// Interval интервал опроса источника. Если 0 - используется PollInterval агента
+	Interval() time.Duration
+	// Collect возвращает актуальные значения метрик.
+	// Counter метрики возвращаются приращением (Delta) с прошлого вызова Collect.
+	// При ошибке может вернуть часть собранных метрик
+	Collect(ctx context.Context) ([]dto.Metrics, error)
+}
+
+// Runner источник метрик с фоновой работой (прием данных по сети, чтение файлов).
+// Агент запускает Run в отдельной горутине до начала опроса и останавливает завершением контекста
+type Runner interface {
+	Run(ctx context.Context) error
+}
+
+// Closer источник метрик, удерживающий открытые файлы или соединения.
+// Агент вызывает Close при остановке, после этого источник не опрашивается
+type Closer interface {
+	Close()
+}
+
+// Registry реестр источников метрик агента.
+// Потокобезопасен, использует sync.RWMutex
+type Registry struct {
+	collectors []Collector
+	mu         sync.RWMutex
+}
+
+// NewRegistry возвращает пустой реестр источников метрик
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register добавляет источник в реестр. Имена источников должны быть уникальны
+func (r *Registry) Register(c Collector) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, registered := range r.collectors {
+		if registered.Name() == c.Name() {
+			return fmt.Errorf("collector %q already registered", c.Name())
+		}
+	}
+
+	r.collectors = append(r.collectors, c)
+	return nil
+}
+
+// Collectors возвращает копию списка зарегистрированных источников в порядке регистрации
+func (r *Registry) Collectors() []Collector {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	collectors := make([]Collector, len(r.collectors))
+	copy(collectors, r.collectors)
+	return collectors
+}
+
+// Close закрывает источники, реализующие Closer, и очищает реестр
+func (r *Registry) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range r.collectors {
+		if closer, ok := c.(Closer); ok {
+			closer.Close()
+		}
+	}
+	r.collectors = nil
+}
+
+// Gauge собирает DTO gauge метрики
+func Gauge(id string, value float64) dto.Metrics {
+	return dto.Metrics{
+		ID:    id,
+		MType: "gauge",
+		Value: &value,
+	}
+}
+
+// Counter собирает DTO counter метрики с приращением delta
+func Counter(id string, delta int64) dto.Metrics {
+	return dto.Metrics{
+		ID:    id,
+		MType: "counter",
+		Delta: &delta,
+	}
+}
+
+// joinErrors объединяет ошибки частичного опроса источника в одну ошибку
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Errorf("%d errors: %s", len(errs), strings.Join(messages, "; "))
+}
+
+// NearestRank квантиль q отсортированного непустого слайса методом ближайшего ранга.
+// Используется для перцентилей StatsD таймеров и агрегатов gauge метрик агента
+func NearestRank(sorted []float64, q float64) float64 {
+	rank := int(math.Ceil(q * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+func TestRegistry_Register(t *testing.T) {
+	registry := NewRegistry()
+
+	require.NoError(t, registry.Register(NewRuntimeCollector(time.Second)))
+	require.NoError(t, registry.Register(NewMemoryCollector(time.Second)))
+
+	// повторная регистрация источника с тем же именем запрещена
+	assert.Error(t, registry.Register(NewRuntimeCollector(2*time.Second)))
+
+	collectors := registry.Collectors()
+	require.Len(t, collectors, 2)
+	assert.Equal(t, "runtime", collectors[0].Name())
+	assert.Equal(t, "memory", collectors[1].Name())
+}
+
+func TestRegistry_Close(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, os.WriteFile(logPath, []byte("error\n"), 0o600))
+
+	logTail := NewLogTailCollector(time.Second, []LogFile{{
+		Path:          logPath,
+		FromBeginning: true,
+		Rules:         []LogRule{{Name: "Errors", Regex: regexp.MustCompile(`error`), Type: "counter"}},
+	}}, "")
+	registry := NewRegistry()
+	require.NoError(t, registry.Register(logTail))
+	require.NoError(t, registry.Register(NewMemoryCollector(time.Second)))
+
+	_, err := logTail.Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, logTail.states, 1)
+
+	// файлы источников закрываются, закрытый источник не открывает их повторно
+	registry.Close()
+	assert.Empty(t, logTail.states)
+	assert.Empty(t, registry.Collectors())
+
+	metrics, err := logTail.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+	assert.Empty(t, logTail.states)
+}
+
+func TestRuntimeCollector_Collect(t *testing.T) {
+	metrics, err := NewRuntimeCollector(time.Second).Collect(context.Background())
+	require.NoError(t, err)
+
+	gauges := make(map[string]float64)
+	counters := make(map[string]int64)
+	for _, metric := range metrics {
+		switch metric.MType {
+		case "gauge":
+			gauges[metric.ID] = *metric.Value
+		case "counter":
+			counters[metric.ID] = *metric.Delta
+		}
+	}
+
+	for _, field := range runtimeMemStatFields {
+		assert.Contains(t, gauges, field)
+	}
+	assert.Greater(t, gauges["Sys"], float64(0))
+	// счетчик опросов собирается отдельным источником, который не отключается вместе с MemStats
+	assert.NotContains(t, gauges, "RandomValue")
+	assert.Empty(t, counters)
+}
+
+func TestPollCollector_Collect(t *testing.T) {
+	metrics, err := NewPollCollector(time.Second).Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+
+	byID := make(map[string]dto.Metrics)
+	for _, metric := range metrics {
+		byID[metric.ID] = metric
+	}
+	assert.Equal(t, "gauge", byID["RandomValue"].MType)
+	assert.Equal(t, "counter", byID["PollCount"].MType)
+	assert.Equal(t, int64(1), *byID["PollCount"].Delta)
+}
+
+func TestNearestRank(t *testing.T) {
+	sorted := []float64{15, 20, 35, 40, 50}
+
+	assert.Equal(t, float64(15), NearestRank(sorted, 0))
+	assert.Equal(t, float64(20), NearestRank(sorted, 0.3))
+	assert.Equal(t, float64(35), NearestRank(sorted, 0.5))
+	assert.Equal(t, float64(50), NearestRank(sorted, 0.95))
+	assert.Equal(t, float64(50), NearestRank(sorted, 1))
+	assert.Equal(t, float64(7), NearestRank([]float64{7}, 0.99))
+}
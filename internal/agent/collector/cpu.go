@@ -0,0 +1,142 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+// CPUCollector метрики утилизации CPU по снимкам cpu.Times между опросами.
+// Для каждого ядра N и для всех ядер вместе (суффикс total) отправляются проценты времени
+// CPUUser_N, CPUSystem_N, CPUIdle_N, CPUIowait_N, CPUSteal_N, CPUIrq_N (irq + softirq),
+// а также общая утилизация CPUutilizationN и CPUutilizationTotal.
+// Первый опрос только запоминает снимок, значения отправляются начиная со второго
+type CPUCollector struct {
+	interval time.Duration
+	previous map[string]cpu.TimesStat
+	mu       sync.Mutex
+}
+
+// cpuBreakdown доли времени CPU между двумя снимками в процентах
+type cpuBreakdown struct {
+	user, system, idle, iowait, steal, irq float64
+}
+
+var _ Collector = (*CPUCollector)(nil)
+
+// NewCPUCollector возвращает источник метрик утилизации CPU с интервалом опроса interval
+func NewCPUCollector(interval time.Duration) *CPUCollector {
+	return &CPUCollector{
+		interval: interval,
+		previous: make(map[string]cpu.TimesStat),
+	}
+}
+
+// Name имя источника
+func (c *CPUCollector) Name() string {
+	return "cpu"
+}
+
+// Interval интервал опроса источника
+func (c *CPUCollector) Interval() time.Duration {
+	return c.interval
+}
+
+// Collect возвращает распределение времени CPU с прошлого опроса по ядрам и суммарно
+func (c *CPUCollector) Collect(ctx context.Context) ([]dto.Metrics, error) {
+	perCore, err := cpu.TimesWithContext(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	total, err := cpu.TimesWithContext(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	metrics := make([]dto.Metrics, 0, 7*(len(perCore)+len(total)))
+	for core, current := range perCore {
+		if breakdown, ok := c.breakdown(current); ok {
+			metrics = append(metrics, breakdown.metrics(fmt.Sprintf("%v", core))...)
+			metrics = append(metrics, Gauge(fmt.Sprintf("CPUutilization%v", core), breakdown.utilization()))
+		}
+	}
+	for _, current := range total {
+		if breakdown, ok := c.breakdown(current); ok {
+			metrics = append(metrics, breakdown.metrics("total")...)
+			metrics = append(metrics, Gauge("CPUutilizationTotal", breakdown.utilization()))
+		}
+	}
+
+	return metrics, nil
+}
+
+// breakdown вычисляет распределение времени с прошлого снимка и запоминает текущий
+func (c *CPUCollector) breakdown(current cpu.TimesStat) (cpuBreakdown, bool) {
+	previous, ok := c.previous[current.CPU]
+	c.previous[current.CPU] = current
+	if !ok {
+		return cpuBreakdown{}, false
+	}
+
+	return cpuTimesBreakdown(previous, current)
+}
+
+// cpuTimesBreakdown доли времени между снимками previous и current.
+// Если время не изменилось или уменьшилось (ядро переподключено), результата нет
+func cpuTimesBreakdown(previous, current cpu.TimesStat) (cpuBreakdown, bool) {
+	elapsed := cpuTotalTime(current) - cpuTotalTime(previous)
+	if elapsed <= 0 {
+		return cpuBreakdown{}, false
+	}
+
+	percent := func(previous, current float64) float64 {
+		delta := current - previous
+		if delta < 0 {
+			return 0
+		}
+		return delta / elapsed * 100
+	}
+
+	return cpuBreakdown{
+		user:   percent(previous.User+previous.Nice, current.User+current.Nice),
+		system: percent(previous.System, current.System),
+		idle:   percent(previous.Idle, current.Idle),
+		iowait: percent(previous.Iowait, current.Iowait),
+		steal:  percent(previous.Steal, current.Steal),
+		irq:    percent(previous.Irq+previous.Softirq, current.Irq+current.Softirq),
+	}, true
+}
+
+// cpuTotalTime суммарное время CPU. Guest уже учтено в User, поэтому не складывается
+func cpuTotalTime(t cpu.TimesStat) float64 {
+	return t.User + t.Nice + t.System + t.Idle + t.Iowait + t.Irq + t.Softirq + t.Steal
+}
+
+// utilization доля времени, когда CPU был занят
+func (b cpuBreakdown) utilization() float64 {
+	busy := 100 - b.idle - b.iowait
+	if busy < 0 {
+		return 0
+	}
+	return busy
+}
+
+// metrics gauge метрики распределения времени с суффиксом suffix
+func (b cpuBreakdown) metrics(suffix string) []dto.Metrics {
+	return []dto.Metrics{
+		Gauge("CPUUser_"+suffix, b.user),
+		Gauge("CPUSystem_"+suffix, b.system),
+		Gauge("CPUIdle_"+suffix, b.idle),
+		Gauge("CPUIowait_"+suffix, b.iowait),
+		Gauge("CPUSteal_"+suffix, b.steal),
+		Gauge("CPUIrq_"+suffix, b.irq),
+	}
+}
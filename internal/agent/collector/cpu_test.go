@@ -0,0 +1,29 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCPUTimesBreakdown(t *testing.T) {
+	previous := cpu.TimesStat{CPU: "cpu0", User: 100, System: 50, Idle: 800, Iowait: 10, Irq: 5, Softirq: 5, Steal: 0}
+	// за интервал прошло 200 единиц времени: 40 user + 10 nice, 20 system, 100 idle, 20 iowait, 4 irq + 2 softirq, 4 steal
+	current := cpu.TimesStat{CPU: "cpu0", User: 140, Nice: 10, System: 70, Idle: 900, Iowait: 30, Irq: 9, Softirq: 7, Steal: 4}
+
+	breakdown, ok := cpuTimesBreakdown(previous, current)
+	require.True(t, ok)
+	assert.InDelta(t, 25, breakdown.user, 1e-9)
+	assert.InDelta(t, 10, breakdown.system, 1e-9)
+	assert.InDelta(t, 50, breakdown.idle, 1e-9)
+	assert.InDelta(t, 10, breakdown.iowait, 1e-9)
+	assert.InDelta(t, 3, breakdown.irq, 1e-9)
+	assert.InDelta(t, 2, breakdown.steal, 1e-9)
+	assert.InDelta(t, 40, breakdown.utilization(), 1e-9)
+
+	// время не изменилось - результата нет
+	_, ok = cpuTimesBreakdown(current, current)
+	assert.False(t, ok)
+}
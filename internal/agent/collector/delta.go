@@ -0,0 +1,28 @@
+package collector
+
+// deltaTracker переводит накопительные значения системных счетчиков в приращения с прошлого опроса.
+// Не потокобезопасен, используется внутри одного источника
+type deltaTracker struct {
+	previous map[string]uint64
+}
+
+// newDeltaTracker возвращает пустой deltaTracker
+func newDeltaTracker() *deltaTracker {
+	return &deltaTracker{previous: make(map[string]uint64)}
+}
+
+// delta возвращает приращение счетчика id с прошлого вызова.
+// При первом наблюдении счетчика возвращает 0, при сбросе счетчика (current < previous) - current
+func (d *deltaTracker) delta(id string, current uint64) int64 {
+	previous, seen := d.previous[id]
+	d.previous[id] = current
+
+	switch {
+	case !seen:
+		return 0
+	case current < previous:
+		return int64(current)
+	default:
+		return int64(current - previous)
+	}
+}
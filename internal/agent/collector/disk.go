@@ -0,0 +1,131 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+// DiskCollector метрики заполнения файловых систем и дискового ввода-вывода.
+// Для каждой точки монтирования отправляются gauge DiskUsed_, DiskFree_, DiskInodesUsed_, DiskInodesFree_,
+// для каждого устройства - counter DiskReadBytes_, DiskWriteBytes_, DiskReadCount_, DiskWriteCount_
+type DiskCollector struct {
+	interval    time.Duration
+	mountpoints Filter
+	counters    *deltaTracker
+	mu          sync.Mutex
+}
+
+var _ Collector = (*DiskCollector)(nil)
+
+// NewDiskCollector возвращает источник дисковых метрик.
+// mountpoints ограничивает список опрашиваемых точек монтирования
+func NewDiskCollector(interval time.Duration, mountpoints Filter) *DiskCollector {
+	return &DiskCollector{
+		interval:    interval,
+		mountpoints: mountpoints,
+		counters:    newDeltaTracker(),
+	}
+}
+
+// Name имя источника
+func (c *DiskCollector) Name() string {
+	return "disk"
+}
+
+// Interval интервал опроса источника
+func (c *DiskCollector) Interval() time.Duration {
+	return c.interval
+}
+
+// Collect возвращает заполнение разрешенных точек монтирования и ввод-вывод их устройств
+func (c *DiskCollector) Collect(ctx context.Context) ([]dto.Metrics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	partitions, err := disk.PartitionsWithContext(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		metrics []dto.Metrics
+		errs    []error
+		devices []string
+	)
+
+	for _, partition := range partitions {
+		if !c.mountpoints.Allow(partition.Mountpoint) {
+			continue
+		}
+
+		usage, uErr := disk.UsageWithContext(ctx, partition.Mountpoint)
+		if uErr != nil {
+			errs = append(errs, fmt.Errorf("disk usage %v: %w", partition.Mountpoint, uErr))
+			continue
+		}
+
+		suffix := MetricSuffix(partition.Mountpoint)
+		metrics = append(metrics,
+			Gauge("DiskUsed_"+suffix, float64(usage.Used)),
+			Gauge("DiskFree_"+suffix, float64(usage.Free)),
+			Gauge("DiskInodesUsed_"+suffix, float64(usage.InodesUsed)),
+			Gauge("DiskInodesFree_"+suffix, float64(usage.InodesFree)),
+		)
+
+		if device := diskDeviceName(partition.Device); !containsString(devices, device) {
+			devices = append(devices, device)
+		}
+	}
+
+	if len(devices) == 0 {
+		return metrics, joinErrors(errs)
+	}
+
+	ioCounters, err := disk.IOCountersWithContext(ctx, devices...)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("disk io counters: %w", err))
+		return metrics, joinErrors(errs)
+	}
+
+	for device, io := range ioCounters {
+		suffix := MetricSuffix(device)
+		metrics = append(metrics,
+			Counter("DiskReadBytes_"+suffix, c.counters.delta("DiskReadBytes_"+suffix, io.ReadBytes)),
+			Counter("DiskWriteBytes_"+suffix, c.counters.delta("DiskWriteBytes_"+suffix, io.WriteBytes)),
+			Counter("DiskReadCount_"+suffix, c.counters.delta("DiskReadCount_"+suffix, io.ReadCount)),
+			Counter("DiskWriteCount_"+suffix, c.counters.delta("DiskWriteCount_"+suffix, io.WriteCount)),
+		)
+	}
+
+	return metrics, joinErrors(errs)
+}
+
+// diskDeviceName имя устройства раздела в disk.IOCounters.
+// Ссылки вида /dev/mapper/vg-root и /dev/disk/by-uuid/... разрешаются в устройство, на которое указывают (dm-0, sda1).
+// Если ссылку разрешить не удалось или устройство виртуальное (tmpfs, overlay), используется последний элемент пути
+func diskDeviceName(device string) string {
+	if !filepath.IsAbs(device) {
+		return filepath.Base(device)
+	}
+	if resolved, err := filepath.EvalSymlinks(device); err == nil {
+		device = resolved
+	}
+	return filepath.Base(device)
+}
+
+// containsString проверяет наличие value в values
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
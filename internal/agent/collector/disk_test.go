@@ -0,0 +1,56 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_diskDeviceName(t *testing.T) {
+	// каталог повторяет устройство LVM: /dev/mapper/vg-root -> ../dm-3
+	dev := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dev, "dm-3"), nil, 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(dev, "mapper"), 0o700))
+	require.NoError(t, os.Symlink("../dm-3", filepath.Join(dev, "mapper", "vg-root")))
+	require.NoError(t, os.Mkdir(filepath.Join(dev, "by-uuid"), 0o700))
+	require.NoError(t, os.Symlink(filepath.Join(dev, "mapper", "vg-root"), filepath.Join(dev, "by-uuid", "4b1f")))
+
+	tests := []struct {
+		name   string
+		device string
+		want   string
+	}{
+		{name: "device mapper link", device: filepath.Join(dev, "mapper", "vg-root"), want: "dm-3"},
+		{name: "link to link", device: filepath.Join(dev, "by-uuid", "4b1f"), want: "dm-3"},
+		{name: "block device", device: filepath.Join(dev, "dm-3"), want: "dm-3"},
+		{name: "missing device", device: "/dev/nonexistent-sda1", want: "nonexistent-sda1"},
+		{name: "virtual file system", device: "tmpfs", want: "tmpfs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, diskDeviceName(tt.device))
+		})
+	}
+}
+
+func TestDiskCollector_Collect_Filter(t *testing.T) {
+	// точки монтирования, не прошедшие фильтр, не опрашиваются
+	c := NewDiskCollector(time.Second, Filter{Include: []string{"/nonexistent-mountpoint"}})
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+
+	c = NewDiskCollector(time.Second, Filter{Include: []string{"/"}})
+	metrics, _ = c.Collect(context.Background())
+	for _, metric := range metrics {
+		if strings.HasPrefix(metric.ID, "DiskUsed_") || strings.HasPrefix(metric.ID, "DiskFree_") {
+			assert.True(t, strings.HasSuffix(metric.ID, "_root"), metric.ID)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+// ExecCollector запускает внешнюю команду и разбирает метрики из ее вывода.
+// Поддерживаются два формата stdout:
+//   - JSON массив dto.Metrics, такой же как принимает сервер на /updates/
+//   - построчный текст "<имя> <gauge|counter> <значение>", пустые строки и строки с # пропускаются
+//
+// Значение counter - приращение с прошлого запуска.
+// Ошибки и таймауты команды отправляются счетчиками ExecErrors_<имя> и ExecTimeouts_<имя>
+type ExecCollector struct {
+	name     string
+	command  string
+	args     []string
+	interval time.Duration
+	timeout  time.Duration
+}
+
+var _ Collector = (*ExecCollector)(nil)
+
+// NewExecCollector возвращает источник метрик, запускающий command с аргументами args.
+// Если timeout равен 0, команда ограничена интервалом опроса
+func NewExecCollector(name, command string, args []string, interval, timeout time.Duration) *ExecCollector {
+	return &ExecCollector{
+		name:     name,
+		command:  command,
+		args:     args,
+		interval: interval,
+		timeout:  timeout,
+	}
+}
+
+// Name имя источника
+func (c *ExecCollector) Name() string {
+	return "exec:" + c.name
+}
+
+// Interval интервал опроса источника
+func (c *ExecCollector) Interval() time.Duration {
+	return c.interval
+}
+
+// Collect запускает команду и возвращает разобранные из stdout метрики
+// вместе со счетчиками ошибок запуска
+func (c *ExecCollector) Collect(ctx context.Context) ([]dto.Metrics, error) {
+	timeout := c.timeout
+	if timeout <= 0 {
+		timeout = c.interval
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.command, c.args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	suffix := MetricSuffix(c.name)
+	errorCounters := func(failed, timedOut bool) []dto.Metrics {
+		var errCount, timeoutCount int64
+		if failed {
+			errCount = 1
+		}
+		if timedOut {
+			timeoutCount = 1
+		}
+		return []dto.Metrics{
+			Counter("ExecErrors_"+suffix, errCount),
+			Counter("ExecTimeouts_"+suffix, timeoutCount),
+		}
+	}
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return errorCounters(true, true), fmt.Errorf("exec %v: timeout after %v", c.name, timeout)
+		}
+		return errorCounters(true, false), fmt.Errorf("exec %v: %w: %s", c.name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	metrics, err := ParseExecOutput(stdout.Bytes())
+	if err != nil {
+		return errorCounters(true, false), fmt.Errorf("exec %v: %w", c.name, err)
+	}
+
+	return append(metrics, errorCounters(false, false)...), nil
+}
+
+// ParseExecOutput разбирает вывод внешней команды в формате JSON массива dto.Metrics
+// или построчного текста "<имя> <gauge|counter> <значение>"
+func ParseExecOutput(output []byte) ([]dto.Metrics, error) {
+	trimmed := bytes.TrimSpace(output)
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		var metrics []dto.Metrics
+		if err := json.Unmarshal(trimmed, &metrics); err != nil {
+			return nil, fmt.Errorf("invalid JSON output: %w", err)
+		}
+		for _, metric := range metrics {
+			if err := validateMetric(metric); err != nil {
+				return nil, err
+			}
+		}
+		return metrics, nil
+	}
+
+	var metrics []dto.Metrics
+	scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		metric, err := parseMetricLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		metrics = append(metrics, metric)
+	}
+
+	return metrics, scanner.Err()
+}
+
+// parseMetricLine разбирает строку "<имя> <gauge|counter> <значение>"
+func parseMetricLine(line string) (dto.Metrics, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return dto.Metrics{}, fmt.Errorf("expected \"<name> <type> <value>\", got %q", line)
+	}
+
+	switch fields[1] {
+	case "gauge":
+		value, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return dto.Metrics{}, fmt.Errorf("invalid gauge %v value: %w", fields[0], err)
+		}
+		return Gauge(fields[0], value), nil
+	case "counter":
+		delta, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return dto.Metrics{}, fmt.Errorf("invalid counter %v value: %w", fields[0], err)
+		}
+		return Counter(fields[0], delta), nil
+	default:
+		return dto.Metrics{}, fmt.Errorf("unknown metric type %q", fields[1])
+	}
+}
+
+// validateMetric проверяет, что у метрики есть имя и значение нужного типа
+func validateMetric(metric dto.Metrics) error {
+	if metric.ID == "" {
+		return errors.New("metric without id")
+	}
+
+	switch {
+	case metric.MType == "gauge" && metric.Value != nil:
+		return nil
+	case metric.MType == "counter" && metric.Delta != nil:
+		return nil
+	default:
+		return fmt.Errorf("metric %v: invalid type %q or missing value", metric.ID, metric.MType)
+	}
+}
@@ -0,0 +1,58 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExecOutput(t *testing.T) {
+	tt := []struct {
+		testName string
+		output   string
+		expected int
+		wantErr  bool
+	}{
+		{"Text format", "# comment\nQueueSize gauge 12.5\n\nJobsDone counter 3\n", 2, false},
+		{"JSON format", `[{"id":"QueueSize","type":"gauge","value":12.5},{"id":"JobsDone","type":"counter","delta":3}]`, 2, false},
+		{"Empty output", "", 0, false},
+		{"Unknown type", "QueueSize histogram 1\n", 0, true},
+		{"Invalid counter value", "JobsDone counter 1.5\n", 0, true},
+		{"Wrong field count", "QueueSize 12\n", 0, true},
+		{"JSON without value", `[{"id":"QueueSize","type":"gauge"}]`, 0, true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.testName, func(t *testing.T) {
+			metrics, err := ParseExecOutput([]byte(tc.output))
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, metrics, tc.expected)
+		})
+	}
+}
+
+func TestExecCollector_Collect(t *testing.T) {
+	c := NewExecCollector("queue", "sh", []string{"-c", "echo 'QueueSize gauge 7'"}, time.Second, 0)
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, float64(7), gaugeValue(t, metrics, "QueueSize"))
+	assert.Equal(t, int64(0), counterValue(t, metrics, "ExecErrors_queue"))
+
+	c = NewExecCollector("broken", "sh", []string{"-c", "exit 3"}, time.Second, 0)
+	metrics, err = c.Collect(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, int64(1), counterValue(t, metrics, "ExecErrors_broken"))
+	assert.Equal(t, int64(0), counterValue(t, metrics, "ExecTimeouts_broken"))
+
+	c = NewExecCollector("slow", "sleep", []string{"5"}, time.Second, 50*time.Millisecond)
+	metrics, err = c.Collect(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, int64(1), counterValue(t, metrics, "ExecTimeouts_slow"))
+}
@@ -0,0 +1,57 @@
+package collector
+
+import (
+	"path"
+	"strings"
+)
+
+// Filter список разрешенных и запрещенных имен (точек монтирования, интерфейсов и тд.).
+// Элементы списков - шаблоны path.Match. Пустой Include разрешает все имена,
+// Exclude имеет приоритет над Include
+type Filter struct {
+	Include []string
+	Exclude []string
+}
+
+// Allow проверяет, проходит ли имя через фильтр
+func (f Filter) Allow(name string) bool {
+	if matchAny(f.Exclude, name) {
+		return false
+	}
+
+	return len(f.Include) == 0 || matchAny(f.Include, name)
+}
+
+// matchAny возвращает true, если имя подходит хотя бы под один шаблон.
+// Некорректные шаблоны сравниваются с именем как строки
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		matched, err := path.Match(pattern, name)
+		if err != nil {
+			matched = pattern == name
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// MetricSuffix приводит имя устройства, точки монтирования, интерфейса или источника к виду,
+// допустимому в имени метрики: все символы кроме букв и цифр заменяются на "_".
+// Корневая точка монтирования "/" превращается в "root"
+func MetricSuffix(name string) string {
+	suffix := strings.Trim(strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name), "_")
+
+	if suffix == "" {
+		return "root"
+	}
+	return suffix
+}
@@ -0,0 +1,47 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter_Allow(t *testing.T) {
+	tt := []struct {
+		testName string
+		filter   Filter
+		name     string
+		allowed  bool
+	}{
+		{"Empty filter allows everything", Filter{}, "/var/lib", true},
+		{"Included by exact name", Filter{Include: []string{"/"}}, "/", true},
+		{"Not in include list", Filter{Include: []string{"/"}}, "/boot", false},
+		{"Included by pattern", Filter{Include: []string{"/mnt/*"}}, "/mnt/data", true},
+		{"Exclude wins over include", Filter{Include: []string{"/mnt/*"}, Exclude: []string{"/mnt/tmp"}}, "/mnt/tmp", false},
+		{"Excluded by pattern", Filter{Exclude: []string{"veth*"}}, "veth12ab", false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.allowed, tc.filter.Allow(tc.name))
+		})
+	}
+}
+
+func TestMetricSuffix(t *testing.T) {
+	assert.Equal(t, "root", MetricSuffix("/"))
+	assert.Equal(t, "var_lib", MetricSuffix("/var/lib"))
+	assert.Equal(t, "sda1", MetricSuffix("sda1"))
+	assert.Equal(t, "eth0_100", MetricSuffix("eth0.100"))
+}
+
+func TestDeltaTracker(t *testing.T) {
+	tracker := newDeltaTracker()
+
+	// первое наблюдение - базовая точка
+	assert.Equal(t, int64(0), tracker.delta("bytes", 100))
+	assert.Equal(t, int64(50), tracker.delta("bytes", 150))
+	assert.Equal(t, int64(0), tracker.delta("bytes", 150))
+	// счетчик сброшен
+	assert.Equal(t, int64(20), tracker.delta("bytes", 20))
+}
@@ -0,0 +1,78 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+// HostCollector общие метрики хоста: средняя загрузка за 1/5/15 минут,
+// количество процессов (работающих, заблокированных, всего), время работы и время загрузки
+type HostCollector struct {
+	interval time.Duration
+}
+
+var _ Collector = (*HostCollector)(nil)
+
+// NewHostCollector возвращает источник метрик хоста с интервалом опроса interval
+func NewHostCollector(interval time.Duration) *HostCollector {
+	return &HostCollector{interval: interval}
+}
+
+// Name имя источника
+func (c *HostCollector) Name() string {
+	return "host"
+}
+
+// Interval интервал опроса источника
+func (c *HostCollector) Interval() time.Duration {
+	return c.interval
+}
+
+// Collect возвращает LoadAverage1/5/15, ProcsRunning, ProcsBlocked, ProcsTotal, Uptime и BootTime.
+// Ошибка одного из системных вызовов не мешает отправке остальных метрик
+func (c *HostCollector) Collect(ctx context.Context) ([]dto.Metrics, error) {
+	var (
+		metrics []dto.Metrics
+		errs    []error
+	)
+
+	if avg, err := load.AvgWithContext(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("load average: %w", err))
+	} else {
+		metrics = append(metrics,
+			Gauge("LoadAverage1", avg.Load1),
+			Gauge("LoadAverage5", avg.Load5),
+			Gauge("LoadAverage15", avg.Load15),
+		)
+	}
+
+	if misc, err := load.MiscWithContext(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("process count: %w", err))
+	} else {
+		metrics = append(metrics,
+			Gauge("ProcsRunning", float64(misc.ProcsRunning)),
+			Gauge("ProcsBlocked", float64(misc.ProcsBlocked)),
+			Gauge("ProcsTotal", float64(misc.ProcsTotal)),
+		)
+	}
+
+	if uptime, err := host.UptimeWithContext(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("uptime: %w", err))
+	} else {
+		metrics = append(metrics, Gauge("Uptime", float64(uptime)))
+	}
+
+	if bootTime, err := host.BootTimeWithContext(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("boot time: %w", err))
+	} else {
+		metrics = append(metrics, Gauge("BootTime", float64(bootTime)))
+	}
+
+	return metrics, joinErrors(errs)
+}
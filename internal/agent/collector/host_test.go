@@ -0,0 +1,33 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostCollector_Collect(t *testing.T) {
+	c := NewHostCollector(time.Second)
+	assert.Equal(t, "host", c.Name())
+	assert.Equal(t, time.Second, c.Interval())
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, 8)
+
+	for _, id := range []string{"LoadAverage1", "LoadAverage5", "LoadAverage15", "ProcsBlocked"} {
+		assert.GreaterOrEqual(t, gaugeValue(t, metrics, id), float64(0), id)
+	}
+	// как минимум процесс теста
+	assert.GreaterOrEqual(t, gaugeValue(t, metrics, "ProcsTotal"), float64(1))
+	assert.GreaterOrEqual(t, gaugeValue(t, metrics, "ProcsTotal"), gaugeValue(t, metrics, "ProcsRunning"))
+
+	// время загрузки и время работы согласованы с текущим временем
+	uptime := gaugeValue(t, metrics, "Uptime")
+	bootTime := gaugeValue(t, metrics, "BootTime")
+	assert.Greater(t, uptime, float64(0))
+	assert.InDelta(t, float64(time.Now().Unix()), bootTime+uptime, 5)
+}
@@ -0,0 +1,397 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+// logFingerprintSize количество байт начала файла, по которым файл опознается после перезапуска агента
+const logFingerprintSize = 256
+
+// logReadChunk размер блока чтения файла
+const logReadChunk = 64 << 10
+
+// LogRule правило извлечения метрики из строки лога.
+// Name может ссылаться на именованные группы регулярного выражения: HTTP_${status}.
+// counter увеличивается на 1 за каждую подходящую строку или на целое значение группы ValueGroup,
+// gauge устанавливается в значение группы ValueGroup
+type LogRule struct {
+	Name       string
+	Regex      *regexp.Regexp
+	Type       string // Type gauge или counter
+	ValueGroup string // ValueGroup имя группы со значением, для gauge обязательно
+}
+
+// LogFile отслеживаемый файл лога и правила извлечения метрик
+type LogFile struct {
+	Path string
+	// FromBeginning читать файл с начала, если для него нет сохраненной позиции.
+	// По умолчанию чтение начинается с конца файла, как tail -f
+	FromBeginning bool
+	Rules         []LogRule
+}
+
+// logOffset сохраняемая позиция чтения файла
+type logOffset struct {
+	Offset      int64  `json:"offset"`
+	Fingerprint string `json:"fingerprint"` // Fingerprint sha256 первых байт файла
+	Size        int    `json:"size"`        // Size количество байт в Fingerprint
+}
+
+// logState состояние чтения одного файла
+type logState struct {
+	file    *os.File
+	info    os.FileInfo
+	offset  int64
+	partial []byte // partial незавершенная строка в конце файла
+}
+
+// LogTailCollector читает дописываемые строки файлов логов и применяет к ним правила.
+// Поддерживается ротация (файл переименован и создан заново) и усечение файла.
+// Позиции чтения сохраняются в offsetsFile, чтобы после перезапуска агента строки не считались повторно
+type LogTailCollector struct {
+	interval    time.Duration
+	files       []LogFile
+	offsetsFile string
+	states      map[string]*logState
+	offsets     map[string]logOffset
+	closed      bool // closed после Close файлы больше не открываются
+	mu          sync.Mutex
+}
+
+var (
+	_ Collector = (*LogTailCollector)(nil)
+	_ Closer    = (*LogTailCollector)(nil)
+)
+
+// NewLogTailCollector возвращает источник метрик из логов.
+// Если offsetsFile пустой, позиции не сохраняются
+func NewLogTailCollector(interval time.Duration, files []LogFile, offsetsFile string) *LogTailCollector {
+	c := &LogTailCollector{
+		interval:    interval,
+		files:       files,
+		offsetsFile: offsetsFile,
+		states:      make(map[string]*logState),
+		offsets:     make(map[string]logOffset),
+	}
+	c.loadOffsets()
+
+	return c
+}
+
+// Name имя источника
+func (c *LogTailCollector) Name() string {
+	return "logtail"
+}
+
+// Interval интервал опроса источника
+func (c *LogTailCollector) Interval() time.Duration {
+	return c.interval
+}
+
+// Collect читает новые строки всех файлов и возвращает метрики по правилам
+func (c *LogTailCollector) Collect(_ context.Context) ([]dto.Metrics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, nil
+	}
+
+	var (
+		errs     []error
+		gauges   = make(map[string]float64)
+		counters = make(map[string]int64)
+	)
+
+	for _, logFile := range c.files {
+		lines, err := c.readLines(logFile)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("log %v: %w", logFile.Path, err))
+		}
+		for _, line := range lines {
+			applyLogRules(logFile.Rules, line, gauges, counters)
+		}
+	}
+
+	if err := c.saveOffsets(); err != nil {
+		errs = append(errs, fmt.Errorf("save log offsets: %w", err))
+	}
+
+	metrics := make([]dto.Metrics, 0, len(gauges)+len(counters))
+	for id, value := range gauges {
+		metrics = append(metrics, Gauge(id, value))
+	}
+	for id, delta := range counters {
+		metrics = append(metrics, Counter(id, delta))
+	}
+
+	return metrics, joinErrors(errs)
+}
+
+// Close закрывает открытые файлы, следующие вызовы Collect не возвращают метрик
+func (c *LogTailCollector) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	for path, state := range c.states {
+		_ = state.file.Close()
+		delete(c.states, path)
+	}
+}
+
+// readLines возвращает новые полные строки файла с учетом ротации и усечения
+func (c *LogTailCollector) readLines(logFile LogFile) ([][]byte, error) {
+	info, err := os.Stat(logFile.Path)
+	if err != nil {
+		// файла нет (например, между ротацией и созданием нового) - дочитываем старый, если он открыт
+		if state, ok := c.states[logFile.Path]; ok {
+			return c.readFrom(logFile.Path, state)
+		}
+		return nil, err
+	}
+
+	state, ok := c.states[logFile.Path]
+	var lines [][]byte
+
+	if ok && !os.SameFile(state.info, info) {
+		// файл ротирован: дочитываем остаток старого файла и переходим на новый с начала
+		lines, err = c.readFrom(logFile.Path, state)
+		_ = state.file.Close()
+		delete(c.states, logFile.Path)
+		ok = false
+		if err != nil {
+			return lines, err
+		}
+
+		state, err = c.open(logFile.Path, 0)
+		if err != nil {
+			return lines, err
+		}
+		c.states[logFile.Path] = state
+		ok = true
+	}
+
+	if !ok {
+		state, err = c.open(logFile.Path, c.startOffset(logFile, info))
+		if err != nil {
+			return nil, err
+		}
+		c.states[logFile.Path] = state
+	}
+
+	if info.Size() < state.offset || c.headChanged(logFile.Path) {
+		// файл усечен (возможно, и дописан до прежнего размера) - читаем с начала
+		state.offset = 0
+		state.partial = nil
+	}
+
+	newLines, err := c.readFrom(logFile.Path, state)
+	return append(lines, newLines...), err
+}
+
+// startOffset позиция начала чтения файла, впервые открытого в этом запуске агента
+func (c *LogTailCollector) startOffset(logFile LogFile, info os.FileInfo) int64 {
+	saved, ok := c.offsets[logFile.Path]
+	if ok && saved.Offset <= info.Size() {
+		fingerprint, size, err := fileFingerprint(logFile.Path, saved.Size)
+		if err == nil && size == saved.Size && fingerprint == saved.Fingerprint {
+			return saved.Offset
+		}
+		// сохраненная позиция относится к другому файлу - он был ротирован, пока агент не работал
+		return 0
+	}
+	if ok || logFile.FromBeginning {
+		return 0
+	}
+	return info.Size()
+}
+
+// headChanged проверяет, изменилось ли начало файла с последнего чтения
+func (c *LogTailCollector) headChanged(path string) bool {
+	saved, ok := c.offsets[path]
+	if !ok || saved.Size == 0 {
+		return false
+	}
+
+	fingerprint, size, err := fileFingerprint(path, saved.Size)
+	return err == nil && (size != saved.Size || fingerprint != saved.Fingerprint)
+}
+
+// open открывает файл и запоминает его идентичность для обнаружения ротации
+func (c *LogTailCollector) open(path string, offset int64) (*logState, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return &logState{file: file, info: info, offset: offset}, nil
+}
+
+// readFrom читает файл с сохраненной позиции до конца, незавершенная строка остается до следующего чтения
+func (c *LogTailCollector) readFrom(path string, state *logState) ([][]byte, error) {
+	var lines [][]byte
+	buf := make([]byte, logReadChunk)
+
+	for {
+		n, err := state.file.ReadAt(buf, state.offset)
+		if n > 0 {
+			state.offset += int64(n)
+			data := append(state.partial, buf[:n]...)
+
+			last := bytes.LastIndexByte(data, '\n')
+			if last < 0 {
+				state.partial = data
+			} else {
+				for _, line := range bytes.Split(data[:last], []byte("\n")) {
+					lines = append(lines, bytes.TrimSuffix(line, []byte("\r")))
+				}
+				state.partial = append([]byte(nil), data[last+1:]...)
+			}
+		}
+
+		if errors.Is(err, io.EOF) || (err == nil && n == 0) {
+			break
+		}
+		if err != nil {
+			return lines, err
+		}
+	}
+
+	c.rememberOffset(path, state)
+	return lines, nil
+}
+
+// rememberOffset запоминает позицию начала незавершенной строки для сохранения на диск
+func (c *LogTailCollector) rememberOffset(path string, state *logState) {
+	offset := state.offset - int64(len(state.partial))
+
+	size := logFingerprintSize
+	if offset < int64(size) {
+		size = int(offset)
+	}
+
+	head := make([]byte, size)
+	n, _ := state.file.ReadAt(head, 0)
+	sum := sha256.Sum256(head[:n])
+
+	c.offsets[path] = logOffset{Offset: offset, Fingerprint: hex.EncodeToString(sum[:]), Size: n}
+}
+
+// fileFingerprint sha256 первых size байт файла
+func fileFingerprint(path string, size int) (string, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	head := make([]byte, size)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", 0, err
+	}
+
+	sum := sha256.Sum256(head[:n])
+	return hex.EncodeToString(sum[:]), n, nil
+}
+
+// loadOffsets загружает сохраненные позиции, ошибки чтения означают отсутствие позиций
+func (c *LogTailCollector) loadOffsets() {
+	if c.offsetsFile == "" {
+		return
+	}
+
+	content, err := os.ReadFile(c.offsetsFile)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(content, &c.offsets)
+}
+
+// saveOffsets атомарно сохраняет позиции чтения через временный файл
+func (c *LogTailCollector) saveOffsets() error {
+	if c.offsetsFile == "" {
+		return nil
+	}
+
+	content, err := json.Marshal(c.offsets)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.offsetsFile), filepath.Base(c.offsetsFile)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.offsetsFile)
+}
+
+// applyLogRules применяет правила к строке и накапливает значения метрик
+func applyLogRules(rules []LogRule, line []byte, gauges map[string]float64, counters map[string]int64) {
+	for _, rule := range rules {
+		match := rule.Regex.FindSubmatchIndex(line)
+		if match == nil {
+			continue
+		}
+
+		id := MetricSuffix(string(rule.Regex.Expand(nil, []byte(rule.Name), line, match)))
+
+		var value []byte
+		if rule.ValueGroup != "" {
+			if group := rule.Regex.SubexpIndex(rule.ValueGroup); group >= 0 && match[2*group] >= 0 {
+				value = line[match[2*group]:match[2*group+1]]
+			}
+		}
+
+		switch rule.Type {
+		case "counter":
+			delta := int64(1)
+			if rule.ValueGroup != "" {
+				parsed, err := strconv.ParseInt(string(value), 10, 64)
+				if err != nil {
+					continue
+				}
+				delta = parsed
+			}
+			counters[id] += delta
+		case "gauge":
+			parsed, err := strconv.ParseFloat(string(value), 64)
+			if err != nil || !isFinite(parsed) {
+				continue
+			}
+			gauges[id] = parsed
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogTailCollector(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "access.log")
+	offsetsPath := filepath.Join(dir, "offsets.json")
+
+	files := []LogFile{{
+		Path:          logPath,
+		FromBeginning: true,
+		Rules: []LogRule{
+			{Name: "HTTP_${status}", Regex: regexp.MustCompile(`status=(?P<status>\d{3})`), Type: "counter"},
+			{Name: "Bytes", Regex: regexp.MustCompile(`bytes=(?P<bytes>\d+)`), Type: "counter", ValueGroup: "bytes"},
+			{Name: "Latency", Regex: regexp.MustCompile(`rt=(?P<rt>[0-9.]+)`), Type: "gauge", ValueGroup: "rt"},
+		},
+	}}
+
+	appendLog := func(content string) {
+		f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		require.NoError(t, err)
+		_, err = f.WriteString(content)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+
+	appendLog("status=200 bytes=10 rt=0.5\nstatus=500 bytes=5 rt=1.5\nstatus=200 bytes=")
+
+	c := NewLogTailCollector(time.Second, files, offsetsPath)
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), counterValue(t, metrics, "HTTP_200"))
+	assert.Equal(t, int64(1), counterValue(t, metrics, "HTTP_500"))
+	assert.Equal(t, int64(15), counterValue(t, metrics, "Bytes"))
+	assert.Equal(t, 1.5, gaugeValue(t, metrics, "Latency"))
+
+	// незавершенная строка дочитывается при следующем опросе
+	appendLog("7 rt=0.1\n")
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), counterValue(t, metrics, "HTTP_200"))
+	assert.Equal(t, int64(7), counterValue(t, metrics, "Bytes"))
+
+	// ротация: остаток старого файла дочитывается, новый читается с начала
+	appendLog("status=404\n")
+	require.NoError(t, os.Rename(logPath, logPath+".1"))
+	appendLog("status=201\n")
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), counterValue(t, metrics, "HTTP_404"))
+	assert.Equal(t, int64(1), counterValue(t, metrics, "HTTP_201"))
+
+	// усечение: файл читается с начала
+	require.NoError(t, os.Truncate(logPath, 0))
+	appendLog("status=202\n")
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, int64(1), counterValue(t, metrics, "HTTP_202"))
+	c.Close()
+
+	// после перезапуска чтение продолжается с сохраненной позиции
+	appendLog("status=203\n")
+	restarted := NewLogTailCollector(time.Second, files, offsetsPath)
+	defer restarted.Close()
+	metrics, err = restarted.Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, int64(1), counterValue(t, metrics, "HTTP_203"))
+}
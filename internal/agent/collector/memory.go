@@ -0,0 +1,45 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/mem"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+// MemoryCollector метрики памяти хоста из mem.VirtualMemoryStat
+type MemoryCollector struct {
+	interval time.Duration
+}
+
+var _ Collector = (*MemoryCollector)(nil)
+
+// NewMemoryCollector возвращает источник метрик mem.VirtualMemoryStat с интервалом опроса interval
+func NewMemoryCollector(interval time.Duration) *MemoryCollector {
+	return &MemoryCollector{interval: interval}
+}
+
+// Name имя источника
+func (c *MemoryCollector) Name() string {
+	return "memory"
+}
+
+// Interval интервал опроса источника
+func (c *MemoryCollector) Interval() time.Duration {
+	return c.interval
+}
+
+// Collect возвращает TotalMemory и FreeMemory хоста
+func (c *MemoryCollector) Collect(ctx context.Context) ([]dto.Metrics, error) {
+	stat, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return []dto.Metrics{
+		Gauge("TotalMemory", float64(stat.Total)),
+		Gauge("FreeMemory", float64(stat.Free)),
+	}, nil
+}
@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/net"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+// NetworkCollector счетчики сетевых интерфейсов: байты, пакеты, ошибки и отброшенные пакеты
+// на прием и передачу. Имена метрик: NetBytesRecv_eth0, NetBytesSent_eth0 и тд.
+type NetworkCollector struct {
+	interval   time.Duration
+	interfaces Filter
+	counters   *deltaTracker
+	mu         sync.Mutex
+}
+
+var _ Collector = (*NetworkCollector)(nil)
+
+// NewNetworkCollector возвращает источник сетевых метрик.
+// interfaces ограничивает список опрашиваемых сетевых интерфейсов
+func NewNetworkCollector(interval time.Duration, interfaces Filter) *NetworkCollector {
+	return &NetworkCollector{
+		interval:   interval,
+		interfaces: interfaces,
+		counters:   newDeltaTracker(),
+	}
+}
+
+// Name имя источника
+func (c *NetworkCollector) Name() string {
+	return "network"
+}
+
+// Interval интервал опроса источника
+func (c *NetworkCollector) Interval() time.Duration {
+	return c.interval
+}
+
+// Collect возвращает приращения счетчиков разрешенных интерфейсов с прошлого опроса
+func (c *NetworkCollector) Collect(ctx context.Context) ([]dto.Metrics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats, err := net.IOCountersWithContext(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.interfaceMetrics(stats), nil
+}
+
+// interfaceMetrics возвращает приращения счетчиков интерфейсов stats, прошедших фильтр, с прошлого опроса
+func (c *NetworkCollector) interfaceMetrics(stats []net.IOCountersStat) []dto.Metrics {
+	metrics := make([]dto.Metrics, 0, len(stats)*8)
+	for _, stat := range stats {
+		if !c.interfaces.Allow(stat.Name) {
+			continue
+		}
+
+		suffix := MetricSuffix(stat.Name)
+		for name, value := range map[string]uint64{
+			"NetBytesRecv_":   stat.BytesRecv,
+			"NetBytesSent_":   stat.BytesSent,
+			"NetPacketsRecv_": stat.PacketsRecv,
+			"NetPacketsSent_": stat.PacketsSent,
+			"NetErrIn_":       stat.Errin,
+			"NetErrOut_":      stat.Errout,
+			"NetDropIn_":      stat.Dropin,
+			"NetDropOut_":     stat.Dropout,
+		} {
+			metrics = append(metrics, Counter(name+suffix, c.counters.delta(name+suffix, value)))
+		}
+	}
+
+	return metrics
+}
@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+func TestNetworkCollector_interfaceMetrics_Filter(t *testing.T) {
+	stats := []net.IOCountersStat{{Name: "eth0"}, {Name: "eth1.100"}, {Name: "lo"}, {Name: "veth12ab"}}
+
+	tt := []struct {
+		testName   string
+		filter     Filter
+		interfaces []string
+	}{
+		{"Empty filter allows every interface", Filter{}, []string{"eth0", "eth1_100", "lo", "veth12ab"}},
+		{"Include by pattern", Filter{Include: []string{"eth*"}}, []string{"eth0", "eth1_100"}},
+		{"Exclude by pattern", Filter{Exclude: []string{"lo", "veth*"}}, []string{"eth0", "eth1_100"}},
+		{"Exclude wins over include", Filter{Include: []string{"eth*"}, Exclude: []string{"eth1*"}}, []string{"eth0"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.testName, func(t *testing.T) {
+			metrics := NewNetworkCollector(time.Second, tc.filter).interfaceMetrics(stats)
+			// по 8 счетчиков на каждый интерфейс
+			assert.Len(t, metrics, 8*len(tc.interfaces))
+
+			ids := make(map[string]bool)
+			for _, metric := range metrics {
+				ids[metric.ID] = true
+			}
+			for _, name := range tc.interfaces {
+				assert.True(t, ids["NetBytesRecv_"+name], name)
+			}
+		})
+	}
+}
+
+func TestNetworkCollector_interfaceMetrics_Delta(t *testing.T) {
+	c := NewNetworkCollector(time.Second, Filter{})
+	poll := func(recv, sent, dropIn uint64) []dto.Metrics {
+		return c.interfaceMetrics([]net.IOCountersStat{{Name: "eth0", BytesRecv: recv, BytesSent: sent, Dropin: dropIn}})
+	}
+
+	// первый опрос только запоминает накопленные значения
+	first := poll(1000, 500, 2)
+	assert.Equal(t, int64(0), counterValue(t, first, "NetBytesRecv_eth0"))
+	assert.Equal(t, int64(0), counterValue(t, first, "NetBytesSent_eth0"))
+
+	// дальше отправляется приращение с прошлого опроса
+	second := poll(1600, 700, 5)
+	assert.Equal(t, int64(600), counterValue(t, second, "NetBytesRecv_eth0"))
+	assert.Equal(t, int64(200), counterValue(t, second, "NetBytesSent_eth0"))
+	assert.Equal(t, int64(3), counterValue(t, second, "NetDropIn_eth0"))
+	assert.Equal(t, int64(0), counterValue(t, second, "NetErrIn_eth0"))
+
+	// счетчики интерфейса сброшены, например после пересоздания - приращением считается новое значение
+	reset := poll(100, 700, 5)
+	assert.Equal(t, int64(100), counterValue(t, reset, "NetBytesRecv_eth0"))
+	assert.Equal(t, int64(0), counterValue(t, reset, "NetBytesSent_eth0"))
+}
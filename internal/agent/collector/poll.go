@@ -0,0 +1,40 @@
+package collector
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+// PollCollector счетчик опросов PollCount и случайное значение RandomValue.
+// Не зависит от настроек остальных источников, поэтому регистрируется всегда
+type PollCollector struct {
+	interval time.Duration
+}
+
+var _ Collector = (*PollCollector)(nil)
+
+// NewPollCollector возвращает источник счетчика опросов с интервалом опроса interval
+func NewPollCollector(interval time.Duration) *PollCollector {
+	return &PollCollector{interval: interval}
+}
+
+// Name имя источника
+func (c *PollCollector) Name() string {
+	return "poll"
+}
+
+// Interval интервал опроса источника
+func (c *PollCollector) Interval() time.Duration {
+	return c.interval
+}
+
+// Collect возвращает приращение PollCount на 1 и новое RandomValue
+func (c *PollCollector) Collect(_ context.Context) ([]dto.Metrics, error) {
+	return []dto.Metrics{
+		Gauge("RandomValue", rand.Float64()),
+		Counter("PollCount", 1),
+	}, nil
+}
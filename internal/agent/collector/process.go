@@ -0,0 +1,222 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+// ProcessTarget описание отслеживаемого процесса.
+// Процесс ищется по одному из признаков в порядке приоритета: PIDFile, Name, Cmdline
+type ProcessTarget struct {
+	Label   string         // Label имя процесса в именах метрик
+	PIDFile string         // PIDFile путь к файлу с PID процесса
+	Name    string         // Name точное имя процесса
+	Cmdline *regexp.Regexp // Cmdline регулярное выражение для командной строки процесса
+}
+
+// processInstance идентификатор экземпляра процесса, меняется при перезапуске
+type processInstance struct {
+	pid        int32
+	createTime int64
+}
+
+// ProcessCollector метрики отслеживаемых процессов.
+// Для каждого ProcessTarget отправляются gauge ProcessUp_, ProcessCount_, ProcessCPU_, ProcessRSS_,
+// ProcessFDs_, ProcessThreads_ (суммарно по всем найденным процессам) и counter ProcessRestarts_
+type ProcessCollector struct {
+	interval time.Duration
+	targets  []ProcessTarget
+	// processes кеш процессов по PID, нужен для расчета CPU между опросами
+	processes map[int32]*process.Process
+	// instances основной (самый старый) процесс цели на прошлом опросе
+	instances map[string]processInstance
+	mu        sync.Mutex
+}
+
+var _ Collector = (*ProcessCollector)(nil)
+
+// NewProcessCollector возвращает источник метрик процессов targets
+func NewProcessCollector(interval time.Duration, targets []ProcessTarget) *ProcessCollector {
+	return &ProcessCollector{
+		interval:  interval,
+		targets:   targets,
+		processes: make(map[int32]*process.Process),
+		instances: make(map[string]processInstance),
+	}
+}
+
+// Name имя источника
+func (c *ProcessCollector) Name() string {
+	return "process"
+}
+
+// Interval интервал опроса источника
+func (c *ProcessCollector) Interval() time.Duration {
+	return c.interval
+}
+
+// Collect ищет процессы каждой цели и возвращает их метрики
+func (c *ProcessCollector) Collect(ctx context.Context) ([]dto.Metrics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var (
+		metrics []dto.Metrics
+		errs    []error
+		all     []*process.Process
+		seen    = make(map[int32]bool)
+	)
+
+	for _, target := range c.targets {
+		var (
+			found []*process.Process
+			err   error
+		)
+
+		if target.PIDFile != "" {
+			found, err = c.findByPIDFile(ctx, target.PIDFile)
+		} else {
+			if all == nil {
+				all, err = process.ProcessesWithContext(ctx)
+			}
+			if err == nil {
+				found = c.findByMatch(ctx, all, target)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("process %v: %w", target.Label, err))
+		}
+
+		for _, p := range found {
+			seen[p.Pid] = true
+		}
+
+		metrics = append(metrics, c.collectTarget(ctx, target, found)...)
+	}
+
+	// удаляем из кеша завершившиеся процессы
+	for pid := range c.processes {
+		if !seen[pid] {
+			delete(c.processes, pid)
+		}
+	}
+
+	return metrics, joinErrors(errs)
+}
+
+// collectTarget суммирует метрики найденных процессов цели и определяет перезапуск
+func (c *ProcessCollector) collectTarget(ctx context.Context, target ProcessTarget, found []*process.Process) []dto.Metrics {
+	var (
+		cpuPercent, rss, fds, threads float64
+		primary                       processInstance
+	)
+
+	for _, p := range found {
+		// используем кешированный процесс, он хранит время CPU с прошлого опроса
+		cached, ok := c.processes[p.Pid]
+		if !ok {
+			cached = p
+			c.processes[p.Pid] = p
+		}
+
+		if percent, err := cached.PercentWithContext(ctx, 0); err == nil {
+			cpuPercent += percent
+		}
+		if memory, err := cached.MemoryInfoWithContext(ctx); err == nil {
+			rss += float64(memory.RSS)
+		}
+		if numFDs, err := cached.NumFDsWithContext(ctx); err == nil {
+			fds += float64(numFDs)
+		}
+		if numThreads, err := cached.NumThreadsWithContext(ctx); err == nil {
+			threads += float64(numThreads)
+		}
+
+		createTime, err := cached.CreateTimeWithContext(ctx)
+		if err != nil {
+			continue
+		}
+		if primary.pid == 0 || createTime < primary.createTime {
+			primary = processInstance{pid: cached.Pid, createTime: createTime}
+		}
+	}
+
+	// процесс перезапущен, если сменился основной экземпляр после того как процесс уже наблюдался
+	var restarts int64
+	previous, seen := c.instances[target.Label]
+	if primary.pid != 0 {
+		if seen && previous != primary {
+			restarts = 1
+		}
+		c.instances[target.Label] = primary
+	}
+
+	up := 0.0
+	if len(found) > 0 {
+		up = 1
+	}
+
+	suffix := MetricSuffix(target.Label)
+	return []dto.Metrics{
+		Gauge("ProcessUp_"+suffix, up),
+		Gauge("ProcessCount_"+suffix, float64(len(found))),
+		Gauge("ProcessCPU_"+suffix, cpuPercent),
+		Gauge("ProcessRSS_"+suffix, rss),
+		Gauge("ProcessFDs_"+suffix, fds),
+		Gauge("ProcessThreads_"+suffix, threads),
+		Counter("ProcessRestarts_"+suffix, restarts),
+	}
+}
+
+// findByPIDFile возвращает процесс, PID которого записан в файле
+func (c *ProcessCollector) findByPIDFile(ctx context.Context, pidFile string) ([]*process.Process, error) {
+	content, err := os.ReadFile(pidFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pid, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pid file %v: %w", pidFile, err)
+	}
+
+	p, err := process.NewProcessWithContext(ctx, int32(pid))
+	if err != nil {
+		// процесс из PID файла не запущен - это не ошибка опроса
+		return nil, nil
+	}
+
+	return []*process.Process{p}, nil
+}
+
+// findByMatch возвращает процессы, подходящие по имени или командной строке
+func (c *ProcessCollector) findByMatch(ctx context.Context, all []*process.Process, target ProcessTarget) []*process.Process {
+	var found []*process.Process
+
+	for _, p := range all {
+		switch {
+		case target.Name != "":
+			name, err := p.NameWithContext(ctx)
+			if err == nil && name == target.Name {
+				found = append(found, p)
+			}
+		case target.Cmdline != nil:
+			cmdline, err := p.CmdlineWithContext(ctx)
+			if err == nil && target.Cmdline.MatchString(cmdline) {
+				found = append(found, p)
+			}
+		}
+	}
+
+	return found
+}
@@ -0,0 +1,69 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+func TestProcessCollector_Collect(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "app.pid")
+	writePID := func(pid int) {
+		require.NoError(t, os.WriteFile(pidFile, []byte(strconv.Itoa(pid)+"\n"), 0644))
+	}
+
+	c := NewProcessCollector(time.Second, []ProcessTarget{{Label: "app", PIDFile: pidFile}})
+
+	// процесс теста запущен
+	writePID(os.Getpid())
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, float64(1), gaugeValue(t, metrics, "ProcessUp_app"))
+	assert.Greater(t, gaugeValue(t, metrics, "ProcessRSS_app"), float64(0))
+	assert.Greater(t, gaugeValue(t, metrics, "ProcessThreads_app"), float64(0))
+	assert.Equal(t, int64(0), counterValue(t, metrics, "ProcessRestarts_app"))
+
+	// в PID файле другой процесс - считаем это перезапуском
+	writePID(os.Getppid())
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), counterValue(t, metrics, "ProcessRestarts_app"))
+
+	// PID файла нет - ошибка опроса, процесс считается остановленным
+	require.NoError(t, os.Remove(pidFile))
+	metrics, err = c.Collect(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, float64(0), gaugeValue(t, metrics, "ProcessUp_app"))
+}
+
+// gaugeValue находит gauge метрику по имени
+func gaugeValue(t *testing.T, metrics []dto.Metrics, id string) float64 {
+	t.Helper()
+	for _, metric := range metrics {
+		if metric.ID == id && metric.MType == "gauge" {
+			return *metric.Value
+		}
+	}
+	t.Fatalf("gauge %v not found", id)
+	return 0
+}
+
+// counterValue находит counter метрику по имени
+func counterValue(t *testing.T, metrics []dto.Metrics, id string) int64 {
+	t.Helper()
+	for _, metric := range metrics {
+		if metric.ID == id && metric.MType == "counter" {
+			return *metric.Delta
+		}
+	}
+	t.Fatalf("counter %v not found", id)
+	return 0
+}
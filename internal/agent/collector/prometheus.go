@@ -0,0 +1,441 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+// PrometheusCollector опрашивает HTTP эндпоинты в текстовом формате Prometheus.
+// Имя метрики строится из префикса эндпоинта, имени в Prometheus и пар имя-значение меток,
+// отсортированных по имени метки. Для http://localhost:9100/metrics:
+// http_requests_total{code="200",method="get"} -> localhost_9100_http_requests_total_code_200_method_get.
+// counter отправляются целыми приращениями, gauge и untyped - как gauge.
+// Гистограммы разворачиваются в counter _count, gauge _sum и gauge перцентили _p50, _p90, _p99
+// по наблюдениям с прошлого опроса, summary - в counter _count, gauge _sum и gauge квантили _q<квантиль>
+type PrometheusCollector struct {
+	interval time.Duration
+	targets  []string
+	client   *http.Client
+	counters *deltaTracker
+	mu       sync.Mutex
+}
+
+var _ Collector = (*PrometheusCollector)(nil)
+
+// prometheusHistogramPercentiles перцентили, в которые разворачиваются гистограммы Prometheus
+var prometheusHistogramPercentiles = []struct {
+	suffix   string
+	quantile float64
+}{
+	{"_p50", 0.5},
+	{"_p90", 0.9},
+	{"_p99", 0.99},
+}
+
+// NewPrometheusCollector возвращает источник метрик, опрашивающий URL из targets
+func NewPrometheusCollector(interval time.Duration, targets []string) *PrometheusCollector {
+	return &PrometheusCollector{
+		interval: interval,
+		targets:  targets,
+		client:   &http.Client{Timeout: interval},
+		counters: newDeltaTracker(),
+	}
+}
+
+// Name имя источника
+func (c *PrometheusCollector) Name() string {
+	return "prometheus"
+}
+
+// Interval интервал опроса источника
+func (c *PrometheusCollector) Interval() time.Duration {
+	return c.interval
+}
+
+// Collect опрашивает все эндпоинты, ошибка одного из них не мешает сбору остальных
+func (c *PrometheusCollector) Collect(ctx context.Context) ([]dto.Metrics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var (
+		metrics []dto.Metrics
+		errs    []error
+	)
+
+	for _, target := range c.targets {
+		families, err := c.scrape(ctx, target)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("scrape %v: %w", target, err))
+			continue
+		}
+		metrics = append(metrics, c.flatten(targetPrefix(target), families)...)
+	}
+
+	return metrics, joinErrors(errs)
+}
+
+// scrape загружает и разбирает метрики одного эндпоинта
+func (c *PrometheusCollector) scrape(ctx context.Context, target string) ([]promFamily, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "text/plain")
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %v", response.Status)
+	}
+
+	return parsePrometheusText(response.Body)
+}
+
+// targetPrefix префикс имен метрик эндпоинта: хост и порт, а также путь, если он отличается от /metrics
+func targetPrefix(target string) string {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return MetricSuffix(target) + "_"
+	}
+	if u.Path == "" || u.Path == "/metrics" {
+		return MetricSuffix(u.Host) + "_"
+	}
+	return MetricSuffix(u.Host+u.Path) + "_"
+}
+
+// flatten переводит семейства метрик Prometheus эндпоинта с префиксом prefix в DTO
+func (c *PrometheusCollector) flatten(prefix string, families []promFamily) []dto.Metrics {
+	var metrics []dto.Metrics
+
+	for _, family := range families {
+		switch family.Type {
+		case "counter":
+			for _, sample := range family.Samples {
+				metrics = append(metrics, c.counter(prefix+sample.metricName(), sample.Value))
+			}
+		case "histogram":
+			metrics = append(metrics, c.flattenHistogram(prefix, family)...)
+		case "summary":
+			metrics = append(metrics, c.flattenSummary(prefix, family)...)
+		default:
+			for _, sample := range family.Samples {
+				if isFinite(sample.Value) {
+					metrics = append(metrics, Gauge(prefix+sample.metricName(), sample.Value))
+				}
+			}
+		}
+	}
+
+	return metrics
+}
+
+// flattenHistogram разворачивает гистограмму в _count, _sum и перцентили.
+// Перцентили считаются по приращениям бакетов с прошлого опроса, при первом опросе не отправляются
+func (c *PrometheusCollector) flattenHistogram(prefix string, family promFamily) []dto.Metrics {
+	type bucket struct {
+		le    float64
+		count float64
+	}
+
+	var (
+		metrics []dto.Metrics
+		series  = make(map[string][]bucket)
+	)
+
+	for _, sample := range family.Samples {
+		switch sample.Name {
+		case family.Name + "_count":
+			metrics = append(metrics, c.counter(prefix+sample.metricName(), sample.Value))
+		case family.Name + "_sum":
+			if isFinite(sample.Value) {
+				metrics = append(metrics, Gauge(prefix+sample.metricName(), sample.Value))
+			}
+		case family.Name + "_bucket":
+			le, err := strconv.ParseFloat(sample.label("le"), 64)
+			if err != nil {
+				continue
+			}
+			base := sample.withoutLabel("le")
+			base.Name = family.Name
+			id := prefix + base.metricName()
+			series[id] = append(series[id], bucket{le: le, count: c.bucketDelta(id, le, sample.Value)})
+		}
+	}
+
+	for id, buckets := range series {
+		sort.Slice(buckets, func(i, j int) bool { return buckets[i].le < buckets[j].le })
+
+		// приращения бакетов Prometheus тоже накопительные, переводим в количество наблюдений в каждом бакете
+		bounds := []float64{math.Inf(-1)}
+		counts := make([]uint64, 0, len(buckets))
+		var previous float64
+		for _, b := range buckets {
+			bounds = append(bounds, b.le)
+			counts = append(counts, uint64(math.Max(b.count-previous, 0)))
+			previous = b.count
+		}
+
+		for _, percentile := range prometheusHistogramPercentiles {
+			if value, ok := histogramQuantile(counts, bounds, percentile.quantile); ok {
+				metrics = append(metrics, Gauge(id+percentile.suffix, value))
+			}
+		}
+	}
+
+	return metrics
+}
+
+// flattenSummary разворачивает summary в _count, _sum и квантили
+func (c *PrometheusCollector) flattenSummary(prefix string, family promFamily) []dto.Metrics {
+	var metrics []dto.Metrics
+
+	for _, sample := range family.Samples {
+		switch {
+		case sample.Name == family.Name+"_count":
+			metrics = append(metrics, c.counter(prefix+sample.metricName(), sample.Value))
+		case sample.Name == family.Name+"_sum":
+			if isFinite(sample.Value) {
+				metrics = append(metrics, Gauge(prefix+sample.metricName(), sample.Value))
+			}
+		case sample.Name == family.Name && isFinite(sample.Value):
+			quantile := sample.label("quantile")
+			metrics = append(metrics, Gauge(prefix+sample.withoutLabel("quantile").metricName()+"_q"+MetricSuffix(quantile), sample.Value))
+		}
+	}
+
+	return metrics
+}
+
+// counter возвращает приращение накопительного счетчика Prometheus.
+// Counter агента целочисленный, поэтому значение округляется до целого до вычисления приращения:
+// сумма приращений совпадает с округленным значением счетчика, но счетчики, растущие на доли единицы
+// за опрос (например process_cpu_seconds_total), дают приращения 0 или 1 вместо дробных
+func (c *PrometheusCollector) counter(id string, value float64) dto.Metrics {
+	if !isFinite(value) || value < 0 {
+		value = 0
+	}
+	return Counter(id, c.counters.delta(id, uint64(math.Round(value))))
+}
+
+// bucketDelta возвращает приращение накопительного бакета le гистограммы id с прошлого опроса.
+// Как и в counter, значение бакета округляется до целого до вычисления приращения
+func (c *PrometheusCollector) bucketDelta(id string, le, value float64) float64 {
+	if !isFinite(value) || value < 0 {
+		value = 0
+	}
+	key := fmt.Sprintf("%v{le=%v}", id, le)
+	return float64(c.counters.delta(key, uint64(math.Round(value))))
+}
+
+// isFinite JSON не поддерживает NaN и бесконечности, такие значения не отправляются
+func isFinite(value float64) bool {
+	return !math.IsNaN(value) && !math.IsInf(value, 0)
+}
+
+// promFamily семейство метрик Prometheus: объявленный в # TYPE тип и все строки значений
+type promFamily struct {
+	Name    string
+	Type    string
+	Samples []promSample
+}
+
+// promSample строка значения метрики Prometheus
+type promSample struct {
+	Name   string
+	Labels [][2]string // Labels пары имя-значение, отсортированные по имени
+	Value  float64
+}
+
+// label возвращает значение метки name
+func (s promSample) label(name string) string {
+	for _, l := range s.Labels {
+		if l[0] == name {
+			return l[1]
+		}
+	}
+	return ""
+}
+
+// withoutLabel возвращает копию строки без метки name
+func (s promSample) withoutLabel(name string) promSample {
+	labels := make([][2]string, 0, len(s.Labels))
+	for _, l := range s.Labels {
+		if l[0] != name {
+			labels = append(labels, l)
+		}
+	}
+	s.Labels = labels
+	return s
+}
+
+// metricName имя метрики агента: имя строки и пары имя-значение меток,
+// чтобы строки с одинаковыми значениями разных меток не совпадали
+func (s promSample) metricName() string {
+	name := s.Name
+	for _, l := range s.Labels {
+		name += "_" + MetricSuffix(l[0]) + "_" + MetricSuffix(l[1])
+	}
+	return name
+}
+
+// parsePrometheusText разбирает текстовый формат Prometheus в семейства метрик.
+// Строки без объявленного # TYPE считаются untyped. Временные метки игнорируются
+func parsePrometheusText(r io.Reader) ([]promFamily, error) {
+	var (
+		families []promFamily
+		index    = make(map[string]int)
+	)
+
+	family := func(name string) *promFamily {
+		i, ok := index[name]
+		if !ok {
+			families = append(families, promFamily{Name: name, Type: "untyped"})
+			i = len(families) - 1
+			index[name] = i
+		}
+		return &families[i]
+	}
+
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				family(fields[2]).Type = fields[3]
+			}
+			continue
+		}
+
+		sample, err := parsePromSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+
+		// строки _bucket, _sum, _count принадлежат объявленной гистограмме или summary
+		familyName := sample.Name
+		for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+			base := strings.TrimSuffix(sample.Name, suffix)
+			if i, ok := index[base]; ok && base != sample.Name &&
+				(families[i].Type == "histogram" || families[i].Type == "summary") {
+				familyName = base
+				break
+			}
+		}
+
+		f := family(familyName)
+		f.Samples = append(f.Samples, sample)
+	}
+
+	return families, scanner.Err()
+}
+
+// parsePromSample разбирает строку вида name{label="value",...} value [timestamp]
+func parsePromSample(line string) (promSample, error) {
+	var sample promSample
+
+	nameEnd := strings.IndexAny(line, "{ \t")
+	if nameEnd <= 0 {
+		return sample, fmt.Errorf("invalid sample %q", line)
+	}
+	sample.Name = line[:nameEnd]
+	rest := line[nameEnd:]
+
+	if strings.HasPrefix(rest, "{") {
+		labels, tail, err := parsePromLabels(rest[1:])
+		if err != nil {
+			return sample, err
+		}
+		sample.Labels = labels
+		rest = tail
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return sample, fmt.Errorf("invalid sample value %q", line)
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample, fmt.Errorf("invalid sample value %q: %w", fields[0], err)
+	}
+	sample.Value = value
+
+	return sample, nil
+}
+
+// parsePromLabels разбирает метки до закрывающей фигурной скобки,
+// возвращает отсортированные пары и остаток строки
+func parsePromLabels(s string) ([][2]string, string, error) {
+	var labels [][2]string
+
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if strings.HasPrefix(s, "}") {
+			break
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || len(s) < eq+2 || s[eq+1] != '"' {
+			return nil, "", fmt.Errorf("invalid labels %q", s)
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = s[eq+2:]
+
+		var (
+			value   strings.Builder
+			escaped bool
+			closed  bool
+			i       int
+		)
+		for i = 0; i < len(s); i++ {
+			ch := s[i]
+			switch {
+			case escaped:
+				if ch == 'n' {
+					ch = '\n'
+				}
+				value.WriteByte(ch)
+				escaped = false
+			case ch == '\\':
+				escaped = true
+			case ch == '"':
+				closed = true
+			default:
+				value.WriteByte(ch)
+			}
+			if closed {
+				break
+			}
+		}
+		if !closed {
+			return nil, "", fmt.Errorf("unterminated label %v value", name)
+		}
+
+		labels = append(labels, [2]string{name, value.String()})
+		s = s[i+1:]
+	}
+
+	sort.Slice(labels, func(i, j int) bool { return labels[i][0] < labels[j][0] })
+	return labels, s[1:], nil
+}
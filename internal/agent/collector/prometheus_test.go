@@ -0,0 +1,134 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const promExposition = `# HELP http_requests_total Total requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} %d
+http_requests_total{code="500",method="get"} 3 1395066363000
+# TYPE queue_length gauge
+queue_length 42
+queue_nan NaN
+# TYPE request_duration_seconds histogram
+request_duration_seconds_bucket{le="0.1"} %d
+request_duration_seconds_bucket{le="0.5"} %d
+request_duration_seconds_bucket{le="+Inf"} %[4]d
+request_duration_seconds_sum 17.5
+request_duration_seconds_count %[4]d
+# TYPE rpc_latency summary
+rpc_latency{service="a\"b",quantile="0.5"} 0.012
+rpc_latency_sum{service="a\"b"} 1.5
+rpc_latency_count{service="a\"b"} 120
+`
+
+func TestParsePrometheusText(t *testing.T) {
+	families, err := parsePrometheusText(strings.NewReader(fmt.Sprintf(promExposition, 10, 50, 90, 100)))
+	require.NoError(t, err)
+
+	types := make(map[string]string)
+	samples := make(map[string]int)
+	for _, family := range families {
+		types[family.Name] = family.Type
+		samples[family.Name] = len(family.Samples)
+	}
+
+	assert.Equal(t, "counter", types["http_requests_total"])
+	assert.Equal(t, "untyped", types["queue_nan"])
+	assert.Equal(t, 5, samples["request_duration_seconds"])
+	assert.Equal(t, 3, samples["rpc_latency"])
+
+	_, err = parsePrometheusText(strings.NewReader(`broken{label="x} 1`))
+	assert.Error(t, err)
+}
+
+func TestPrometheusCollector_Collect(t *testing.T) {
+	requests, fast, medium, observations := 10, 50, 90, 100
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, promExposition, requests, fast, medium, observations)
+	}))
+	defer ts.Close()
+
+	prefix := targetPrefix(ts.URL)
+	c := NewPrometheusCollector(time.Second, []string{ts.URL})
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	// при первом опросе приращений бакетов нет, перцентили не отправляются
+	for _, metric := range metrics {
+		assert.NotEqual(t, prefix+"request_duration_seconds_p50", metric.ID)
+	}
+
+	// за окно: 5 наблюдений до 0.1, 3 до 0.5, 2 больше 0.5
+	requests, fast, medium, observations = 15, 55, 98, 110
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+
+	// метки отсортированы по имени: code, method
+	assert.Equal(t, int64(5), counterValue(t, metrics, prefix+"http_requests_total_code_200_method_post"))
+	assert.Equal(t, int64(0), counterValue(t, metrics, prefix+"http_requests_total_code_500_method_get"))
+	assert.Equal(t, float64(42), gaugeValue(t, metrics, prefix+"queue_length"))
+	assert.Equal(t, int64(10), counterValue(t, metrics, prefix+"request_duration_seconds_count"))
+	assert.Equal(t, 17.5, gaugeValue(t, metrics, prefix+"request_duration_seconds_sum"))
+	assert.Equal(t, 0.1, gaugeValue(t, metrics, prefix+"request_duration_seconds_p50"))
+	assert.Equal(t, 0.5, gaugeValue(t, metrics, prefix+"request_duration_seconds_p90"))
+	assert.Equal(t, 0.012, gaugeValue(t, metrics, prefix+"rpc_latency_service_a_b_q0_5"))
+	assert.Equal(t, 1.5, gaugeValue(t, metrics, prefix+"rpc_latency_sum_service_a_b"))
+
+	for _, metric := range metrics {
+		assert.NotEqual(t, prefix+"queue_nan", metric.ID)
+	}
+}
+
+func TestPrometheusCollector_Collect_Targets(t *testing.T) {
+	newTarget := func(total *int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "# TYPE jobs_total counter\njobs_total{a=\"x\"} %d\njobs_total{b=\"x\"} 1\n", *total)
+		}))
+	}
+	first, second := 100, 7
+	one := newTarget(&first)
+	defer one.Close()
+	two := newTarget(&second)
+	defer two.Close()
+
+	c := NewPrometheusCollector(time.Second, []string{one.URL, two.URL})
+	_, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	first, second = 103, 9
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	// одна и та же строка двух эндпоинтов учитывается отдельно, метки с одинаковыми значениями не совпадают
+	assert.Equal(t, int64(3), counterValue(t, metrics, targetPrefix(one.URL)+"jobs_total_a_x"))
+	assert.Equal(t, int64(2), counterValue(t, metrics, targetPrefix(two.URL)+"jobs_total_a_x"))
+	assert.Equal(t, int64(0), counterValue(t, metrics, targetPrefix(one.URL)+"jobs_total_b_x"))
+	assert.Len(t, metrics, 4)
+}
+
+func Test_targetPrefix(t *testing.T) {
+	assert.Equal(t, "localhost_9100_", targetPrefix("http://localhost:9100/metrics"))
+	assert.Equal(t, "app_8080_debug_vars_", targetPrefix("http://app:8080/debug/vars"))
+}
+
+func TestPrometheusCollector_counter_Fractional(t *testing.T) {
+	c := NewPrometheusCollector(time.Second, nil)
+
+	// дробный счетчик округляется до целого до вычисления приращения
+	var total int64
+	for _, value := range []float64{0.2, 0.6, 0.9, 1.4, 1.6} {
+		total += *c.counter("process_cpu_seconds_total", value).Delta
+	}
+	assert.Equal(t, int64(2), total)
+}
@@ -0,0 +1,218 @@
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+// pushMaxBodySize ограничение размера тела запроса к локальному эндпоинту
+const pushMaxBodySize = 10 << 20
+
+// PushCollector локальный HTTP эндпоинт агента (sidecar режим).
+// Приложения на том же хосте отправляют метрики в формате сервера:
+// POST /update/ - одна метрика dto.Metrics, POST /updates/ - JSON массив метрик, поддерживается gzip.
+// Метрики буферизуются до следующего опроса: gauge - последнее значение, counter - сумма приращений.
+// Подпись и шифрование выполняет агент при отправке, поле hash от приложений игнорируется.
+// Принимаются только запросы с loopback адресов
+type PushCollector struct {
+	address  string
+	interval time.Duration
+	server   *http.Server
+	listener net.Listener
+	ready    chan struct{}
+	gauges   map[string]float64
+	counters map[string]int64
+	mu       sync.Mutex
+}
+
+var (
+	_ Collector = (*PushCollector)(nil)
+	_ Runner    = (*PushCollector)(nil)
+)
+
+// NewPushCollector возвращает источник метрик, принимающий их по HTTP на address
+func NewPushCollector(address string, interval time.Duration) *PushCollector {
+	c := &PushCollector{
+		address:  address,
+		interval: interval,
+		ready:    make(chan struct{}),
+		gauges:   make(map[string]float64),
+		counters: make(map[string]int64),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/update/", c.handleUpdate(false))
+	mux.HandleFunc("/updates/", c.handleUpdate(true))
+	c.server = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	return c
+}
+
+// Name имя источника
+func (c *PushCollector) Name() string {
+	return "push"
+}
+
+// Interval интервал опроса источника
+func (c *PushCollector) Interval() time.Duration {
+	return c.interval
+}
+
+// Addr адрес, на котором принимаются запросы. Доступен после запуска Run
+func (c *PushCollector) Addr() net.Addr {
+	<-c.ready
+	if c.listener == nil {
+		return nil
+	}
+	return c.listener.Addr()
+}
+
+// Run запускает HTTP сервер до завершения контекста
+func (c *PushCollector) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", c.address)
+	if err != nil {
+		close(c.ready)
+		return fmt.Errorf("push listen %v: %w", c.address, err)
+	}
+	c.listener = listener
+	close(c.ready)
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = c.server.Shutdown(shutdownCtx)
+	}()
+
+	if err = c.server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("push serve: %w", err)
+	}
+	return nil
+}
+
+// Collect возвращает накопленные с прошлого опроса метрики и очищает буфер
+func (c *PushCollector) Collect(_ context.Context) ([]dto.Metrics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	metrics := make([]dto.Metrics, 0, len(c.gauges)+len(c.counters))
+	for id, value := range c.gauges {
+		metrics = append(metrics, Gauge(id, value))
+	}
+	for id, delta := range c.counters {
+		metrics = append(metrics, Counter(id, delta))
+	}
+
+	c.gauges = make(map[string]float64)
+	c.counters = make(map[string]int64)
+
+	return metrics, nil
+}
+
+// handleUpdate обработчик приема одной метрики или массива метрик
+func (c *PushCollector) handleUpdate(batch bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !isLoopback(r.RemoteAddr) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		metrics, err := decodePushBody(r, batch)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		c.buffer(metrics)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(struct {
+			Status   string
+			Accepted int
+		}{Status: "OK", Accepted: len(metrics)})
+	}
+}
+
+// buffer добавляет метрики в буфер до следующего опроса
+func (c *PushCollector) buffer(metrics []dto.Metrics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, metric := range metrics {
+		switch metric.MType {
+		case "gauge":
+			c.gauges[metric.ID] = *metric.Value
+		case "counter":
+			c.counters[metric.ID] += *metric.Delta
+		}
+	}
+}
+
+// decodePushBody читает одну метрику или массив метрик из тела запроса.
+// Запрос отклоняется целиком, если хотя бы одна метрика некорректна
+func decodePushBody(r *http.Request, batch bool) ([]dto.Metrics, error) {
+	var body io.Reader = http.MaxBytesReader(nil, r.Body, pushMaxBodySize)
+	defer r.Body.Close()
+
+	if strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("bad gzip body: %w", err)
+		}
+		defer gz.Close()
+		body = io.LimitReader(gz, pushMaxBodySize)
+	}
+
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("can't read body: %w", err)
+	}
+
+	var metrics []dto.Metrics
+	if batch {
+		err = json.Unmarshal(content, &metrics)
+	} else {
+		var metric dto.Metrics
+		err = json.Unmarshal(bytes.TrimSpace(content), &metric)
+		metrics = []dto.Metrics{metric}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bad JSON: %w", err)
+	}
+
+	for _, metric := range metrics {
+		if err = validateMetric(metric); err != nil {
+			return nil, err
+		}
+	}
+
+	return metrics, nil
+}
+
+// isLoopback проверяет, что запрос пришел с loopback адреса
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
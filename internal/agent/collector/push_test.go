@@ -0,0 +1,57 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPushCollector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := NewPushCollector("127.0.0.1:0", time.Second)
+	go func() {
+		assert.NoError(t, c.Run(ctx))
+	}()
+	baseURL := fmt.Sprintf("http://%v", c.Addr())
+
+	tt := []struct {
+		testName   string
+		endpoint   string
+		body       string
+		statusCode int
+	}{
+		{"Single gauge", "/update/", `{"id":"QueueSize","type":"gauge","value":5}`, http.StatusOK},
+		{"Batch", "/updates/", `[{"id":"QueueSize","type":"gauge","value":7},{"id":"Jobs","type":"counter","delta":2}]`, http.StatusOK},
+		{"Counter is summed", "/update/", `{"id":"Jobs","type":"counter","delta":3}`, http.StatusOK},
+		{"Bad JSON", "/updates/", `[{"id":`, http.StatusBadRequest},
+		{"Missing value", "/update/", `{"id":"QueueSize","type":"gauge"}`, http.StatusBadRequest},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.testName, func(t *testing.T) {
+			resp, err := http.Post(baseURL+tc.endpoint, "application/json", strings.NewReader(tc.body))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tc.statusCode, resp.StatusCode)
+		})
+	}
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	assert.Equal(t, float64(7), gaugeValue(t, metrics, "QueueSize"))
+	assert.Equal(t, int64(5), counterValue(t, metrics, "Jobs"))
+
+	// буфер очищается после опроса
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+}
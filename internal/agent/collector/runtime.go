@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"time"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+// runtimeMemStatFields поля runtime.MemStats, которые отправляются как gauge метрики с тем же именем
+var runtimeMemStatFields = []string{
+	"Alloc", "BuckHashSys", "Frees", "GCCPUFraction", "GCSys",
+	"HeapAlloc", "HeapIdle", "HeapInuse", "HeapObjects", "HeapReleased", "HeapSys",
+	"LastGC", "Lookups", "MCacheInuse", "MCacheSys", "MSpanInuse", "MSpanSys",
+	"Mallocs", "NextGC", "NumForcedGC", "NumGC", "OtherSys", "PauseTotalNs",
+	"StackInuse", "StackSys", "Sys", "TotalAlloc",
+}
+
+// RuntimeCollector метрики из runtime.MemStats
+type RuntimeCollector struct {
+	interval time.Duration
+}
+
+var _ Collector = (*RuntimeCollector)(nil)
+
+// NewRuntimeCollector возвращает источник метрик runtime.MemStats с интервалом опроса interval
+func NewRuntimeCollector(interval time.Duration) *RuntimeCollector {
+	return &RuntimeCollector{interval: interval}
+}
+
+// Name имя источника
+func (c *RuntimeCollector) Name() string {
+	return "runtime"
+}
+
+// Interval интервал опроса источника
+func (c *RuntimeCollector) Interval() time.Duration {
+	return c.interval
+}
+
+// Collect читает runtime.MemStats и возвращает gauge метрики по списку runtimeMemStatFields
+func (c *RuntimeCollector) Collect(_ context.Context) ([]dto.Metrics, error) {
+	var stat runtime.MemStats
+	runtime.ReadMemStats(&stat)
+
+	metrics := make([]dto.Metrics, 0, len(runtimeMemStatFields))
+	statValue := reflect.ValueOf(stat)
+
+	for _, field := range runtimeMemStatFields {
+		metrics = append(metrics, Gauge(field, numericValue(statValue.FieldByName(field))))
+	}
+
+	return metrics, nil
+}
+
+// numericValue приводит числовое поле структуры к float64
+func numericValue(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,165 @@
+package collector
+
+import (
+	"context"
+	"math"
+	"runtime/metrics"
+	"sync"
+	"time"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+// runtimeHistogramPercentiles перцентили, в которые разворачиваются гистограммы runtime/metrics
+var runtimeHistogramPercentiles = []struct {
+	suffix   string
+	quantile float64
+}{
+	{"_p50", 0.5},
+	{"_p90", 0.9},
+	{"_p99", 0.99},
+}
+
+// RuntimeMetricsCollector метрики рантайма Go из runtime/metrics.
+// Опрашивает все поддерживаемые версией Go метрики без остановки мира, в отличие от runtime.ReadMemStats.
+// Имя метрики строится из имени в runtime/metrics: /sched/goroutines:goroutines -> Runtime_sched_goroutines_goroutines.
+// Накопительные целочисленные метрики отправляются counter приращениями, остальные скалярные - gauge.
+// Гистограммы (паузы GC, задержки планировщика) разворачиваются в gauge перцентили _p50, _p90, _p99
+// по значениям, накопленным с прошлого опроса
+type RuntimeMetricsCollector struct {
+	interval    time.Duration
+	samples     []metrics.Sample
+	cumulative  map[string]bool
+	counters    *deltaTracker
+	histograms  map[string][]uint64 // histograms счетчики гистограмм на прошлом опросе
+	metricNames map[string]string
+	mu          sync.Mutex
+}
+
+var _ Collector = (*RuntimeMetricsCollector)(nil)
+
+// NewRuntimeMetricsCollector возвращает источник метрик runtime/metrics с интервалом опроса interval
+func NewRuntimeMetricsCollector(interval time.Duration) *RuntimeMetricsCollector {
+	descriptions := metrics.All()
+
+	c := &RuntimeMetricsCollector{
+		interval:    interval,
+		samples:     make([]metrics.Sample, len(descriptions)),
+		cumulative:  make(map[string]bool, len(descriptions)),
+		counters:    newDeltaTracker(),
+		histograms:  make(map[string][]uint64),
+		metricNames: make(map[string]string, len(descriptions)),
+	}
+
+	for i, description := range descriptions {
+		c.samples[i].Name = description.Name
+		c.cumulative[description.Name] = description.Cumulative
+		c.metricNames[description.Name] = "Runtime_" + MetricSuffix(description.Name)
+	}
+
+	return c
+}
+
+// Name имя источника
+func (c *RuntimeMetricsCollector) Name() string {
+	return "runtime_metrics"
+}
+
+// Interval интервал опроса источника
+func (c *RuntimeMetricsCollector) Interval() time.Duration {
+	return c.interval
+}
+
+// Collect читает все метрики runtime/metrics
+func (c *RuntimeMetricsCollector) Collect(_ context.Context) ([]dto.Metrics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	metrics.Read(c.samples)
+
+	result := make([]dto.Metrics, 0, len(c.samples))
+	for _, sample := range c.samples {
+		name := c.metricNames[sample.Name]
+
+		switch sample.Value.Kind() {
+		case metrics.KindUint64:
+			value := sample.Value.Uint64()
+			if c.cumulative[sample.Name] {
+				result = append(result, Counter(name, c.counters.delta(name, value)))
+			} else {
+				result = append(result, Gauge(name, float64(value)))
+			}
+		case metrics.KindFloat64:
+			result = append(result, Gauge(name, sample.Value.Float64()))
+		case metrics.KindFloat64Histogram:
+			result = append(result, c.flattenHistogram(name, sample.Value.Float64Histogram())...)
+		default:
+			// метрика не поддерживается текущей версией рантайма
+			continue
+		}
+	}
+
+	return result, nil
+}
+
+// flattenHistogram возвращает перцентили гистограммы по наблюдениям с прошлого опроса.
+// Если новых наблюдений не было, метрики не возвращаются и на сервере остаются прошлые значения
+func (c *RuntimeMetricsCollector) flattenHistogram(name string, histogram *metrics.Float64Histogram) []dto.Metrics {
+	window := make([]uint64, len(histogram.Counts))
+	previous := c.histograms[name]
+	for i, count := range histogram.Counts {
+		window[i] = count
+		if len(previous) == len(histogram.Counts) && count >= previous[i] {
+			window[i] = count - previous[i]
+		}
+	}
+	c.histograms[name] = append(previous[:0], histogram.Counts...)
+
+	result := make([]dto.Metrics, 0, len(runtimeHistogramPercentiles))
+	for _, percentile := range runtimeHistogramPercentiles {
+		value, ok := histogramQuantile(window, histogram.Buckets, percentile.quantile)
+		if !ok {
+			return nil
+		}
+		result = append(result, Gauge(name+percentile.suffix, value))
+	}
+
+	return result
+}
+
+// histogramQuantile оценивает квантиль q по счетчикам гистограммы.
+// buckets содержит len(counts)+1 границ, значением считается верхняя граница бакета,
+// для бесконечной верхней границы - нижняя. Возвращает false для пустой гистограммы
+func histogramQuantile(counts []uint64, buckets []float64, q float64) (float64, bool) {
+	var total uint64
+	for _, count := range counts {
+		total += count
+	}
+	if total == 0 || len(buckets) != len(counts)+1 {
+		return 0, false
+	}
+
+	rank := uint64(math.Ceil(q * float64(total)))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var cumulative uint64
+	for i, count := range counts {
+		cumulative += count
+		if cumulative < rank {
+			continue
+		}
+
+		upper := buckets[i+1]
+		if math.IsInf(upper, 1) {
+			upper = buckets[i]
+		}
+		if math.IsInf(upper, -1) {
+			return 0, true
+		}
+		return upper, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,49 @@
+package collector
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramQuantile(t *testing.T) {
+	buckets := []float64{math.Inf(-1), 1, 2, 4, math.Inf(1)}
+
+	// 10 наблюдений: 5 в (-inf, 1], 4 в (1, 2], 1 в (4, +inf)
+	counts := []uint64{5, 4, 0, 1}
+
+	value, ok := histogramQuantile(counts, buckets, 0.5)
+	require.True(t, ok)
+	assert.Equal(t, float64(1), value)
+
+	value, _ = histogramQuantile(counts, buckets, 0.9)
+	assert.Equal(t, float64(2), value)
+
+	// верхний бакет бесконечен - берем его нижнюю границу
+	value, _ = histogramQuantile(counts, buckets, 0.99)
+	assert.Equal(t, float64(4), value)
+
+	_, ok = histogramQuantile([]uint64{0, 0, 0, 0}, buckets, 0.5)
+	assert.False(t, ok)
+}
+
+func TestRuntimeMetricsCollector_Collect(t *testing.T) {
+	c := NewRuntimeMetricsCollector(time.Second)
+
+	_, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	// между опросами происходит сборка мусора - появляются перцентили пауз GC
+	runtime.GC()
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	assert.Greater(t, gaugeValue(t, metrics, "Runtime_sched_goroutines_goroutines"), float64(0))
+	assert.GreaterOrEqual(t, counterValue(t, metrics, "Runtime_gc_cycles_total_gc_cycles"), int64(1))
+	gaugeValue(t, metrics, "Runtime_gc_pauses_seconds_p99")
+}
@@ -0,0 +1,255 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+// statsdMaxPacketSize максимальный размер UDP пакета StatsD
+const statsdMaxPacketSize = 65535
+
+// statsdTimerPercentiles перцентили, отправляемые для таймеров ms
+var statsdTimerPercentiles = []struct {
+	suffix   string
+	quantile float64
+}{
+	{"_p50", 0.5},
+	{"_p90", 0.9},
+	{"_p99", 0.99},
+}
+
+// StatsDCollector принимает метрики по протоколу StatsD (UDP) и агрегирует их за окно отправки.
+// Поддерживаются типы:
+//   - c - счетчик, значения суммируются с учетом частоты семплирования @rate, отправляется counter.
+//     Дробный остаток суммы переносится в следующее окно
+//   - g - gauge, значение со знаком +/- изменяет текущее, отправляется последнее значение
+//   - ms - таймер, отправляются gauge <имя>_last, _min, _max, _p50, _p90, _p99 и counter <имя>_count
+//   - s - множество, отправляется gauge с количеством уникальных значений за окно
+//
+// В именах метрик все символы кроме букв и цифр заменяются на "_". Теги (#tag) игнорируются
+type StatsDCollector struct {
+	address  string
+	interval time.Duration
+	conn     net.PacketConn
+	ready    chan struct{}
+	window   *statsdWindow
+	// gauges текущие значения gauge, сохраняются между окнами для относительных изменений
+	gauges map[string]float64
+	// remainders дробные остатки сумм счетчиков, не вошедшие в отправленное целое значение
+	remainders map[string]float64
+	mu         sync.Mutex
+}
+
+// statsdWindow данные, накопленные за одно окно отправки
+type statsdWindow struct {
+	counters map[string]float64
+	gauges   map[string]bool
+	timers   map[string][]float64
+	sets     map[string]map[string]struct{}
+}
+
+var (
+	_ Collector = (*StatsDCollector)(nil)
+	_ Runner    = (*StatsDCollector)(nil)
+)
+
+// NewStatsDCollector возвращает источник StatsD метрик, слушающий UDP address.
+// interval - окно агрегации, обычно совпадает с ReportInterval агента
+func NewStatsDCollector(address string, interval time.Duration) *StatsDCollector {
+	return &StatsDCollector{
+		address:    address,
+		interval:   interval,
+		ready:      make(chan struct{}),
+		window:     newStatsdWindow(),
+		gauges:     make(map[string]float64),
+		remainders: make(map[string]float64),
+	}
+}
+
+// newStatsdWindow возвращает пустое окно агрегации
+func newStatsdWindow() *statsdWindow {
+	return &statsdWindow{
+		counters: make(map[string]float64),
+		gauges:   make(map[string]bool),
+		timers:   make(map[string][]float64),
+		sets:     make(map[string]map[string]struct{}),
+	}
+}
+
+// Name имя источника
+func (c *StatsDCollector) Name() string {
+	return "statsd"
+}
+
+// Interval интервал опроса источника - окно агрегации
+func (c *StatsDCollector) Interval() time.Duration {
+	return c.interval
+}
+
+// Addr адрес, на котором принимаются пакеты. Доступен после запуска Run
+func (c *StatsDCollector) Addr() net.Addr {
+	<-c.ready
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.LocalAddr()
+}
+
+// Run принимает UDP пакеты до завершения контекста
+func (c *StatsDCollector) Run(ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", c.address)
+	if err != nil {
+		close(c.ready)
+		return fmt.Errorf("statsd listen %v: %w", c.address, err)
+	}
+	c.conn = conn
+	close(c.ready)
+
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+
+	buf := make([]byte, statsdMaxPacketSize)
+	for {
+		n, _, rErr := conn.ReadFrom(buf)
+		if rErr != nil {
+			if ctx.Err() != nil || errors.Is(rErr, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("statsd read: %w", rErr)
+		}
+
+		c.handlePacket(string(buf[:n]))
+	}
+}
+
+// handlePacket разбирает пакет, некорректные строки пропускаются
+func (c *StatsDCollector) handlePacket(packet string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		_ = c.handleLine(line)
+	}
+}
+
+// handleLine разбирает строку name:value|type[|@rate][|#tags] и добавляет значение в окно
+func (c *StatsDCollector) handleLine(line string) error {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return fmt.Errorf("invalid statsd line %q", line)
+	}
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return fmt.Errorf("invalid statsd line %q", line)
+	}
+
+	rawValue, metricType := parts[0], parts[1]
+	rate := 1.0
+	for _, option := range parts[2:] {
+		if strings.HasPrefix(option, "@") {
+			parsedRate, err := strconv.ParseFloat(option[1:], 64)
+			if err == nil && parsedRate > 0 && parsedRate <= 1 {
+				rate = parsedRate
+			}
+		}
+	}
+
+	id := MetricSuffix(name)
+	if metricType == "s" {
+		if c.window.sets[id] == nil {
+			c.window.sets[id] = make(map[string]struct{})
+		}
+		c.window.sets[id][rawValue] = struct{}{}
+		return nil
+	}
+
+	value, err := strconv.ParseFloat(rawValue, 64)
+	if err != nil || !isFinite(value) {
+		return fmt.Errorf("invalid statsd value %q", rawValue)
+	}
+
+	switch metricType {
+	case "c":
+		c.window.counters[id] += value / rate
+	case "g":
+		if strings.HasPrefix(rawValue, "+") || strings.HasPrefix(rawValue, "-") {
+			value += c.gauges[id]
+		}
+		c.gauges[id] = value
+		c.window.gauges[id] = true
+	case "ms":
+		c.window.timers[id] = append(c.window.timers[id], value)
+	default:
+		return fmt.Errorf("unknown statsd type %q", metricType)
+	}
+
+	return nil
+}
+
+// Collect возвращает агрегаты текущего окна и начинает новое
+func (c *StatsDCollector) Collect(_ context.Context) ([]dto.Metrics, error) {
+	c.mu.Lock()
+	window := c.window
+	c.window = newStatsdWindow()
+	gauges := make(map[string]float64, len(window.gauges))
+	for id := range window.gauges {
+		gauges[id] = c.gauges[id]
+	}
+	counters := make(map[string]int64, len(window.counters))
+	for id, sum := range window.counters {
+		sum += c.remainders[id]
+		counters[id] = int64(math.Round(sum))
+		if remainder := sum - float64(counters[id]); remainder != 0 {
+			c.remainders[id] = remainder
+		} else {
+			delete(c.remainders, id)
+		}
+	}
+	c.mu.Unlock()
+
+	var metrics []dto.Metrics
+
+	for id, delta := range counters {
+		metrics = append(metrics, Counter(id, delta))
+	}
+
+	for id, value := range gauges {
+		metrics = append(metrics, Gauge(id, value))
+	}
+
+	for id, values := range window.timers {
+		last := values[len(values)-1]
+		sort.Float64s(values)
+		metrics = append(metrics,
+			Gauge(id+"_last", last),
+			Gauge(id+"_min", values[0]),
+			Gauge(id+"_max", values[len(values)-1]),
+			Counter(id+"_count", int64(len(values))),
+		)
+		for _, percentile := range statsdTimerPercentiles {
+			metrics = append(metrics, Gauge(id+percentile.suffix, NearestRank(values, percentile.quantile)))
+		}
+	}
+
+	for id, members := range window.sets {
+		metrics = append(metrics, Gauge(id, float64(len(members))))
+	}
+
+	return metrics, nil
+}
@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+func TestStatsDCollector_Aggregate(t *testing.T) {
+	c := NewStatsDCollector("127.0.0.1:0", time.Second)
+
+	c.handlePacket("app.requests:1|c\napp.requests:2|c|@0.5\n" +
+		"app.queue:10|g\napp.queue:-3|g\n" +
+		"app.latency:30|ms\napp.latency:10|ms\napp.latency:20|ms|#env:prod\n" +
+		"app.users:alice|s\napp.users:bob|s\napp.users:alice|s\n" +
+		"broken line\napp.bad:x|c\n")
+
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	// 1 + 2/0.5
+	assert.Equal(t, int64(5), counterValue(t, metrics, "app_requests"))
+	assert.Equal(t, float64(7), gaugeValue(t, metrics, "app_queue"))
+	assert.Equal(t, float64(20), gaugeValue(t, metrics, "app_latency_last"))
+	assert.Equal(t, float64(10), gaugeValue(t, metrics, "app_latency_min"))
+	assert.Equal(t, float64(30), gaugeValue(t, metrics, "app_latency_max"))
+	assert.Equal(t, float64(20), gaugeValue(t, metrics, "app_latency_p50"))
+	assert.Equal(t, int64(3), counterValue(t, metrics, "app_latency_count"))
+	assert.Equal(t, float64(2), gaugeValue(t, metrics, "app_users"))
+
+	// окно сброшено, относительные gauge считаются от сохраненного значения
+	c.handlePacket("app.queue:+1|g")
+	metrics, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, float64(8), gaugeValue(t, metrics, "app_queue"))
+}
+
+func TestStatsDCollector_CounterRemainder(t *testing.T) {
+	c := NewStatsDCollector("127.0.0.1:0", time.Second)
+
+	// каждое окно получает 1/0.3 = 3.33, дробные остатки не теряются между окнами
+	var total int64
+	for i := 0; i < 3; i++ {
+		c.handlePacket("app.sampled:1|c|@0.3")
+		metrics, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		total += counterValue(t, metrics, "app_sampled")
+	}
+	assert.Equal(t, int64(10), total)
+}
+
+func TestStatsDCollector_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := NewStatsDCollector("127.0.0.1:0", time.Second)
+	go func() {
+		assert.NoError(t, c.Run(ctx))
+	}()
+
+	conn, err := net.Dial("udp", c.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("jobs:4|c"))
+	require.NoError(t, err)
+
+	var total int64
+	assert.Eventually(t, func() bool {
+		metrics, _ := c.Collect(context.Background())
+		total += sumCounters(metrics, "jobs")
+		return total == 4
+	}, time.Second, 10*time.Millisecond)
+}
+
+// sumCounters сумма приращений counter метрики id
+func sumCounters(metrics []dto.Metrics, id string) int64 {
+	var sum int64
+	for _, metric := range metrics {
+		if metric.ID == id && metric.MType == "counter" {
+			sum += *metric.Delta
+		}
+	}
+	return sum
+}
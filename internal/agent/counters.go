@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"sync"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+// counterDeltas учет отправленных значений счетчиков для одного сервера.
+// Хранилище агента содержит накопленные значения счетчиков, а сервер прибавляет полученный Delta к сохраненному,
+// поэтому серверу отправляется только прирост с предыдущего пакета.
+// Прирост резервируется при подготовке пакета, чтобы одновременно отправляемые пакеты не учли его дважды.
+// Прирост пакета, который не отправлен и не сохранен в очередь outbox или вытеснен из нее,
+// возвращается и входит в следующий пакет.
+// Методы nil *counterDeltas возвращают метрики без изменений
+type counterDeltas struct {
+	reported map[string]int64 // reported накопленные значения счетчиков, отправленные или отправляемые на сервер
+	mu       sync.Mutex
+}
+
+// newCounterDeltas учет счетчиков без отправленных значений
+func newCounterDeltas() *counterDeltas {
+	return &counterDeltas{reported: map[string]int64{}}
+}
+
+// take возвращает копию метрик, в которой накопленные значения счетчиков заменены приростом
+// с последнего отправленного значения, и резервирует этот прирост.
+// Пакет, собранный раньше уже отправленного, содержит нулевой прирост
+func (c *counterDeltas) take(metrics []dto.Metrics) []dto.Metrics {
+	if c == nil {
+		return metrics
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	taken := make([]dto.Metrics, len(metrics))
+	for i, metric := range metrics {
+		if metric.MType == "counter" && metric.Delta != nil {
+			delta := *metric.Delta - c.reported[metric.ID]
+			if delta < 0 {
+				delta = 0
+			}
+			c.reported[metric.ID] += delta
+			metric.Delta = &delta
+		}
+		taken[i] = metric
+	}
+
+	return taken
+}
+
+// rollback возвращает прирост счетчиков неотправленного пакета, он войдет в следующий пакет
+func (c *counterDeltas) rollback(metrics []dto.Metrics) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, metric := range metrics {
+		if metric.MType == "counter" && metric.Delta != nil {
+			c.reported[metric.ID] -= *metric.Delta
+		}
+	}
+}
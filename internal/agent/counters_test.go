@@ -0,0 +1,169 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atrian/devmetrics/internal/agent/outbox"
+	"github.com/atrian/devmetrics/internal/appconfig/agentconfig"
+	"github.com/atrian/devmetrics/internal/dto"
+	"github.com/atrian/devmetrics/internal/signature"
+	"github.com/atrian/devmetrics/pkg/logger"
+)
+
+// pollCount пакет с накопленным значением счетчика PollCount
+func pollCount(value int64) []dto.Metrics {
+	return []dto.Metrics{{ID: "PollCount", MType: "counter", Delta: &value}}
+}
+
+func Test_counterDeltas(t *testing.T) {
+	c := newCounterDeltas()
+
+	first := c.take(pollCount(5))
+	assert.Equal(t, int64(5), *first[0].Delta)
+
+	// одновременно отправляемые пакеты не учитывают прирост дважды
+	second := c.take(pollCount(8))
+	assert.Equal(t, int64(3), *second[0].Delta)
+
+	// пакет, собранный раньше отправленного, не содержит прироста
+	stale := c.take(pollCount(6))
+	assert.Equal(t, int64(0), *stale[0].Delta)
+
+	// прирост неотправленного пакета входит в следующий
+	c.rollback(first)
+	next := c.take(pollCount(10))
+	assert.Equal(t, int64(7), *next[0].Delta)
+
+	// исходный пакет не изменяется, он отправляется и на другие серверы
+	batch := pollCount(12)
+	c.take(batch)
+	assert.Equal(t, int64(12), *batch[0].Delta)
+}
+
+// recordingSink запоминает выведенные пакеты, пока fail не установлен
+type recordingSink struct {
+	fail    bool
+	batches []outbox.Batch
+}
+
+func (s *recordingSink) Write(batch outbox.Batch) error {
+	if s.fail {
+		return errors.New("sink is unavailable")
+	}
+	s.batches = append(s.batches, batch)
+	return nil
+}
+
+func (s *recordingSink) Close() error { return nil }
+
+func TestUploader_SendBatch_CounterDeltas(t *testing.T) {
+	agentLogger := logger.NewZapLogger()
+	metrics := NewMetricsDicts(agentLogger, nil, nil)
+	recorder := &recordingSink{}
+	uploader := &Uploader{
+		config: &agentconfig.Config{},
+		destination: agentconfig.DestinationConfig{
+			Name:     "test",
+			Protocol: agentconfig.SinkFile,
+			Retry:    agentconfig.RetryConfig{MaxAttempts: 1},
+		},
+		hasher:   signature.NewSha256Hasher(),
+		sink:     recorder,
+		counters: newCounterDeltas(),
+		logger:   agentLogger,
+	}
+
+	poll := func() {
+		delta := int64(1)
+		metrics.Store([]dto.Metrics{{ID: "PollCount", MType: "counter", Delta: &delta}})
+	}
+	sent := func() int64 {
+		last := recorder.batches[len(recorder.batches)-1]
+		return *exportedByID(last.Metrics)["PollCount"].Delta
+	}
+
+	poll()
+	poll()
+	require.NoError(t, uploader.SendAllStats(metrics))
+	assert.Equal(t, int64(2), sent())
+
+	poll()
+	require.NoError(t, uploader.SendAllStats(metrics))
+	assert.Equal(t, int64(1), sent())
+
+	// пакет не отправлен и очередь outbox не настроена - прирост войдет в следующий пакет
+	poll()
+	recorder.fail = true
+	require.Error(t, uploader.SendAllStats(metrics))
+
+	poll()
+	recorder.fail = false
+	require.NoError(t, uploader.SendAllStats(metrics))
+	assert.Equal(t, int64(2), sent())
+
+	var total int64
+	for _, batch := range recorder.batches {
+		total += *exportedByID(batch.Metrics)["PollCount"].Delta
+	}
+	assert.Equal(t, int64(5), total)
+	assert.Len(t, recorder.batches, 3)
+}
+
+func TestUploader_SendBatch_CounterDeltas_OutboxEviction(t *testing.T) {
+	// очередь вмещает два пакета со счетчиком PollCount
+	size, err := json.Marshal(outbox.Batch{CollectedAt: time.Now(), Metrics: pollCount(1)})
+	require.NoError(t, err)
+	box, err := outbox.New(t.TempDir(), int64(len(size))*5/2)
+	require.NoError(t, err)
+
+	agentLogger := logger.NewZapLogger()
+	metrics := NewMetricsDicts(agentLogger, nil, nil)
+	agentMetrics := NewMetricsDicts(agentLogger, nil, nil)
+	recorder := &recordingSink{fail: true}
+	uploader := &Uploader{
+		config: &agentconfig.Config{},
+		destination: agentconfig.DestinationConfig{
+			Name:     "test",
+			Protocol: agentconfig.SinkFile,
+			Retry:    agentconfig.RetryConfig{MaxAttempts: 1},
+		},
+		hasher:    signature.NewSha256Hasher(),
+		sink:      recorder,
+		outbox:    box,
+		counters:  newCounterDeltas(),
+		telemetry: newTelemetry(agentMetrics),
+		logger:    agentLogger,
+	}
+
+	poll := func() {
+		delta := int64(1)
+		metrics.Store([]dto.Metrics{{ID: "PollCount", MType: "counter", Delta: &delta}})
+	}
+
+	// сервер недоступен, старые пакеты вытесняются из очереди
+	for i := 0; i < 5; i++ {
+		poll()
+		require.Error(t, uploader.SendAllStats(metrics))
+	}
+	assert.Equal(t, 2, box.Len())
+	assert.Equal(t, counter(3), agentMetrics.CounterDict["AgentDroppedMetrics_test_evicted"].value)
+
+	// сервер доступен - очередь и текущий пакет вместе содержат весь прирост
+	poll()
+	recorder.fail = false
+	require.NoError(t, uploader.SendAllStats(metrics))
+	assert.Equal(t, 0, box.Len())
+	assert.Len(t, recorder.batches, 3)
+
+	var total int64
+	for _, batch := range recorder.batches {
+		total += *exportedByID(batch.Metrics)["PollCount"].Delta
+	}
+	assert.Equal(t, int64(6), total)
+}
@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/atrian/devmetrics/internal/agent/outbox"
+	"github.com/atrian/devmetrics/internal/appconfig/agentconfig"
+	"github.com/atrian/devmetrics/pkg/logger"
+)
+
+// destination сервер отправки метрик со своей очередью и воркерами.
+// Серверы обслуживаются независимо, медленный сервер не задерживает отправку на остальные
+type destination struct {
+	uploader *Uploader
+	uploads  *uploadQueue
+	workers  sync.WaitGroup
+	cancel   context.CancelFunc // cancel останавливает проверки доступности адресов
+}
+
+// newDestination подготавливает отправку на сервер destinationConfig.
+// Работа сервера учитывается в метриках агента, см. telemetry
+func newDestination(config *agentconfig.Config, destinationConfig agentconfig.DestinationConfig, metrics *MetricsDics, logger logger.Logger) (*destination, error) {
+	uploader, err := NewUploader(config, destinationConfig, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &destination{
+		uploader: uploader,
+		uploads:  newUploadQueue(config.Agent.UploadQueueSize, config.Agent.OverflowPolicy),
+	}
+
+	d.uploader.telemetry = newTelemetry(metrics)
+	d.uploader.failover.onSwitch = func(from, to string) {
+		d.uploader.telemetry.failoverSwitch(destinationConfig.Name)
+	}
+
+	return d, nil
+}
+
+// push ставит пакет в очередь сервера по политике переполнения
+func (d *destination) push(ctx context.Context, batch outbox.Batch, logger logger.Logger) {
+	dropped := d.uploads.Push(ctx, batch)
+	d.uploader.telemetry.queueDepth(d.uploader.Name(), d.uploads.Len())
+	if dropped > 0 {
+		d.uploader.telemetry.dropped(d.uploader.Name(), dropOverflow, dropped)
+		logger.Warning(fmt.Sprintf("Destination %v: upload queue is full, %v metrics dropped by %v policy",
+			d.uploader.Name(), dropped, d.uploads.policy))
+	}
+}
+
+// run запускает workers воркеров отправки пакетов из очереди сервера и проверки доступности адресов сервера.
+// Проверки останавливаются с завершением контекста, воркеры - после закрытия очереди
+func (d *destination) run(ctx context.Context, workers int, healthCheckInterval time.Duration, logger logger.Logger) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, d.cancel = context.WithCancel(ctx)
+	if d.uploader.failover != nil {
+		go d.uploader.failover.Run(ctx, healthCheckInterval)
+	}
+
+	for i := 0; i < workers; i++ {
+		d.workers.Add(1)
+		go func() {
+			defer d.workers.Done()
+
+			for batch := range d.uploads.Jobs() {
+				d.uploader.telemetry.queueDepth(d.uploader.Name(), d.uploads.Len())
+				if err := d.uploader.SendBatch(batch); err != nil {
+					logger.Error(fmt.Sprintf("Destination %v: upload stats failed", d.uploader.Name()), err)
+					continue
+				}
+				logger.Info(fmt.Sprintf("Destination %v: upload stats. Metrics: %v", d.uploader.Name(), len(batch.Metrics)))
+			}
+		}()
+	}
+}
+
+// stop останавливает проверки адресов, дожидается отправки пакетов из очереди и закрывает соединения сервера.
+// После stop пакеты в очередь не ставятся
+func (d *destination) stop(logger logger.Logger) {
+	if d.cancel != nil {
+		d.cancel()
+	}
+	d.uploads.Close()
+	d.workers.Wait()
+
+	if err := d.uploader.Close(); err != nil {
+		logger.Error(fmt.Sprintf("Destination %v: close connections", d.uploader.Name()), err)
+	}
+}
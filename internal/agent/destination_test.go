@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atrian/devmetrics/internal/appconfig/agentconfig"
+	"github.com/atrian/devmetrics/internal/dto"
+	"github.com/atrian/devmetrics/internal/signature"
+	"github.com/atrian/devmetrics/pkg/logger"
+)
+
+func TestAgent_UploadStats_FanOut(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	received := make(chan []dto.Metrics, 1)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metrics, err := decodeGzipMetrics(r)
+		if err == nil {
+			received <- metrics
+		}
+	}))
+	defer fast.Close()
+
+	agentLogger := logger.NewZapLogger()
+	config := &agentconfig.Config{
+		Transport: agentconfig.TransportConfig{URLTemplate: "%v://%v/", ContentType: "application/json"},
+		Agent:     agentconfig.AgentConfig{UploadQueueSize: 1, OverflowPolicy: OverflowDropOldest},
+	}
+
+	newTestDestination := func(server *httptest.Server, name, hashKey string) *destination {
+		return &destination{
+			uploader: &Uploader{
+				HTTPClient: server.Client(),
+				config:     config,
+				destination: agentconfig.DestinationConfig{
+					Name:     name,
+					Protocol: "http",
+					Address:  strings.TrimPrefix(server.URL, "http://"),
+					HashKey:  hashKey,
+				},
+				hasher: signature.NewSha256Hasher(),
+				logger: agentLogger,
+			},
+			uploads: newUploadQueue(1, OverflowDropOldest),
+		}
+	}
+
+	a := &Agent{
+		config:  config,
+		metrics: NewMetricsDicts(agentLogger, nil, nil),
+		logger:  agentLogger,
+		destinations: []*destination{
+			newTestDestination(slow, "staging", "staging-key"),
+			newTestDestination(fast, "production", "production-key"),
+		},
+	}
+	for _, d := range a.destinations {
+		d.run(context.Background(), 1, 0, agentLogger)
+	}
+
+	value := 42.0
+	a.metrics.Store([]dto.Metrics{{ID: "Alloc", MType: "gauge", Value: &value}})
+	a.UploadStats(context.Background())
+
+	// медленный сервер не задерживает отправку на быстрый
+	select {
+	case metrics := <-received:
+		require.Len(t, metrics, 1)
+		expected := signature.NewSha256Hasher().Hash("Alloc:gauge:42.000000", "production-key")
+		assert.Equal(t, expected, metrics[0].Hash)
+	case <-time.After(time.Second):
+		t.Fatal("fast destination didn't receive metrics")
+	}
+}
+
+// decodeGzipMetrics читает сжатый gzip JSON массив метрик из запроса
+func decodeGzipMetrics(r *http.Request) ([]dto.Metrics, error) {
+	gz, err := gzip.NewReader(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var metrics []dto.Metrics
+	err = json.NewDecoder(gz).Decode(&metrics)
+	return metrics, err
+}
@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atrian/devmetrics/pkg/logger"
+)
+
+// healthCheckTimeout ограничение времени проверки доступности одного адреса
+const healthCheckTimeout = 2 * time.Second
+
+// failover выбирает адрес сервера из списка по приоритету по результатам проверок доступности.
+// Используется первый доступный адрес, при восстановлении более приоритетного адреса отправка возвращается на него.
+// Если недоступны все адреса, текущий адрес не меняется
+type failover struct {
+	name      string
+	addresses []string
+	probe     func(ctx context.Context, index int) error // probe проверка доступности адреса addresses[index]
+	onSwitch  func(from, to string)                      // onSwitch вызывается при смене адреса
+	current   int
+	logger    logger.Logger
+	mu        sync.RWMutex
+}
+
+// newFailover возвращает выбор адреса из addresses, пока проверок не было используется первый адрес
+func newFailover(name string, addresses []string, probe func(ctx context.Context, index int) error, logger logger.Logger) *failover {
+	return &failover{
+		name:      name,
+		addresses: addresses,
+		probe:     probe,
+		logger:    logger,
+	}
+}
+
+// splitAddresses разбирает список адресов через запятую в порядке приоритета
+func splitAddresses(list string) []string {
+	var addresses []string
+	for _, address := range strings.Split(list, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	if len(addresses) == 0 {
+		addresses = []string{""}
+	}
+	return addresses
+}
+
+// Current индекс и адрес, на который выполняется отправка
+func (f *failover) Current() (int, string) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.current, f.addresses[f.current]
+}
+
+// Check проверяет адреса в порядке приоритета и переключается на первый доступный
+func (f *failover) Check(ctx context.Context) {
+	healthy := -1
+	for index := range f.addresses {
+		probeCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		err := f.probe(probeCtx, index)
+		cancel()
+
+		if err == nil {
+			healthy = index
+			break
+		}
+		f.logger.Debug(fmt.Sprintf("Destination %v: %v is unhealthy: %v", f.name, f.addresses[index], err))
+	}
+
+	if healthy < 0 {
+		f.logger.Warning(fmt.Sprintf("Destination %v: no healthy addresses, keep current", f.name))
+		return
+	}
+
+	f.mu.Lock()
+	from := f.addresses[f.current]
+	if healthy == f.current {
+		f.mu.Unlock()
+		return
+	}
+	f.current = healthy
+	onSwitch := f.onSwitch
+	f.mu.Unlock()
+
+	f.logger.Warning(fmt.Sprintf("Destination %v: switched from %v to %v", f.name, from, f.addresses[healthy]))
+	if onSwitch != nil {
+		onSwitch(from, f.addresses[healthy])
+	}
+}
+
+// Run проверяет адреса сразу и далее с интервалом interval до завершения контекста.
+// Для одного адреса проверки не выполняются
+func (f *failover) Run(ctx context.Context, interval time.Duration) {
+	if len(f.addresses) < 2 || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		f.Check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
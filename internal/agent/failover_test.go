@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atrian/devmetrics/internal/appconfig/agentconfig"
+	"github.com/atrian/devmetrics/pkg/logger"
+)
+
+func TestFailover_Check(t *testing.T) {
+	var mu sync.Mutex
+	healthy := map[int]bool{0: true, 1: true}
+	probe := func(ctx context.Context, index int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if !healthy[index] {
+			return errors.New("unhealthy")
+		}
+		return nil
+	}
+	setHealthy := func(index int, value bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		healthy[index] = value
+	}
+
+	f := newFailover("production", []string{"primary:8080", "backup:8080"}, probe, logger.NewZapLogger())
+	var switched []string
+	f.onSwitch = func(from, to string) {
+		switched = append(switched, to)
+	}
+
+	f.Check(context.Background())
+	_, address := f.Current()
+	assert.Equal(t, "primary:8080", address)
+
+	// основной сервер недоступен - переключаемся на резервный
+	setHealthy(0, false)
+	f.Check(context.Background())
+	_, address = f.Current()
+	assert.Equal(t, "backup:8080", address)
+
+	// недоступны все - адрес не меняется
+	setHealthy(1, false)
+	f.Check(context.Background())
+	_, address = f.Current()
+	assert.Equal(t, "backup:8080", address)
+
+	// основной сервер восстановился - возвращаемся на него
+	setHealthy(0, true)
+	f.Check(context.Background())
+	_, address = f.Current()
+	assert.Equal(t, "primary:8080", address)
+
+	assert.Equal(t, []string{"backup:8080", "primary:8080"}, switched)
+}
+
+func TestUploader_probeHTTP(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer down.Close()
+
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/healthz", r.URL.Path)
+	}))
+	defer up.Close()
+
+	config := &agentconfig.Config{Transport: agentconfig.TransportConfig{URLTemplate: "%v://%v/"}}
+	destination := agentconfig.DestinationConfig{
+		Name:     "production",
+		Protocol: "http",
+		Address:  strings.TrimPrefix(down.URL, "http://") + ", " + strings.TrimPrefix(up.URL, "http://"),
+	}
+	uploader, err := NewUploader(config, destination, logger.NewZapLogger())
+	require.NoError(t, err)
+
+	uploader.failover.Check(context.Background())
+	index, _ := uploader.current()
+	assert.Equal(t, 1, index)
+	assert.Equal(t, up.URL+"/updates/", uploader.buildStatsUploadURL())
+}
@@ -1,75 +1,30 @@
 package agent
 
 import (
-	"fmt"
-	"math/rand"
-	"runtime"
 	"sync"
 
-	"github.com/shirou/gopsutil/v3/cpu"
-	"github.com/shirou/gopsutil/v3/mem"
-
+	"github.com/atrian/devmetrics/internal/appconfig/agentconfig"
 	"github.com/atrian/devmetrics/internal/dto"
 	"github.com/atrian/devmetrics/pkg/logger"
 )
 
-// Типы собираемых в приложении метрик
-const (
-	RuntimeMetric = iota // RuntimeMetric метрики из runtime.MemStats
-	GopsMetric           // GopsMetric метрики из mem.VirtualMemoryStat
-	CPUMetric            // CPUMetric метрики CPU утилизации
-)
-
 // MetricsDics In Memory хранилище для собранных метрик.
 // Потокобезопасно, использует sync.RWMutex
 type MetricsDics struct {
 	GaugeDict   map[string]*GaugeMetric   // GaugeDict мапа для хранения метрик
 	CounterDict map[string]*CounterMetric // CounterDict мапа для хранения счетчиков
-	logger      logger.Logger
-	mu          sync.RWMutex
-}
-
-// StatsHolder контейнер для разных источников статистики
-type StatsHolder struct {
-	// RuntimeMemStat указатель на метрики runtime.MemStats
-	RuntimeMemStat *runtime.MemStats
-	// GopsMemStat указатель на метрики mem.VirtualMemoryStat
-	GopsMemStat *mem.VirtualMemoryStat
-	mu          sync.RWMutex
-}
-
-// NewStatsHolder инициализация контейнера с внешними метриками, обновление данных
-func NewStatsHolder() *StatsHolder {
-	sh := StatsHolder{}
-	sh.updateGopsMemStat()
-	sh.updateRuntimeStat()
-
-	return &sh
-}
-
-// updateRuntimeStat обновление метрик runtime.MemStats в контейнере внешних метрик
-// Потокобезопасно, использует sync.RWMutex
-func (sh *StatsHolder) updateRuntimeStat() {
-	sh.mu.Lock()
-	var stat runtime.MemStats
-	runtime.ReadMemStats(&stat)
-	sh.RuntimeMemStat = &stat
-	sh.mu.Unlock()
+	// aggregations правила агрегации gauge метрик за окно отправки
+	aggregations []agentconfig.AggregationConfig
+	// relabel правила фильтрации и переименования метрик при выгрузке
+	relabel []relabelRule
+	logger  logger.Logger
+	mu      sync.RWMutex
 }
 
-// updateGopsMemStat обновление метрик mem.VirtualMemoryStat в контейнере внешних метрик
-// Потокобезопасно, использует sync.RWMutex
-func (sh *StatsHolder) updateGopsMemStat() {
-	sh.mu.Lock()
-	sh.GopsMemStat, _ = mem.VirtualMemory()
-	sh.mu.Unlock()
-}
-
-// GaugeMetric - структура для хранения данных метрики и функции извлечения актуальных показателей
+// GaugeMetric - структура для хранения последнего значения метрики
 type GaugeMetric struct {
-	pullValue func(sh *StatsHolder) gauge // функция обновления данных
-	source    int                         // тип собираемой метрики, RuntimeMetric | GopsMetric | CPUMetric
-	value     gauge                       // текущее значение метрики
+	value  gauge        // текущее значение метрики
+	window *gaugeWindow // window значения за окно отправки, nil - метрика не агрегируется
 }
 
 // getGaugeValue возвращает значение метрики в формате float64
@@ -77,10 +32,9 @@ func (g *GaugeMetric) getGaugeValue() float64 {
 	return float64(g.value)
 }
 
-// CounterMetric - структура для хранения данных счетчика и функция вычисления следующего значения
+// CounterMetric - структура для хранения накопленного значения счетчика
 type CounterMetric struct {
-	calculateNextValue func(c *CounterMetric) counter // функция обновления данных
-	value              counter                        // текущее значение счетчика
+	value counter // текущее значение счетчика
 }
 
 // getCounterValue возвращает значение метрики в формате int64
@@ -88,204 +42,112 @@ func (c *CounterMetric) getCounterValue() int64 {
 	return int64(c.value)
 }
 
-// NewMetricsDicts инициализация хранилища собранных метрик и счетчиков
-// содержит список всех собираемых метрик и счетчиков а так же правила получения/обновления данных
-func NewMetricsDicts(logger logger.Logger) *MetricsDics {
+// NewMetricsDicts инициализация пустого хранилища собранных метрик и счетчиков.
+// Хранилище наполняется данными из источников collector.Collector.
+// Для gauge метрик, подходящих под правила aggregations, при выгрузке отправляются агрегаты за окно.
+// Правила relabel применяются при выгрузке по порядку. Правила проверяются при загрузке конфигурации,
+// если они все же некорректны, метрики не выгружаются, чтобы не отправить то, что должно быть удалено
+func NewMetricsDicts(logger logger.Logger, aggregations []agentconfig.AggregationConfig, relabel []agentconfig.RelabelConfig) *MetricsDics {
 	dict := MetricsDics{
-		GaugeDict: map[string]*GaugeMetric{
-			"Alloc": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.Alloc)
-			}},
-			"BuckHashSys": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.BuckHashSys)
-			}},
-			"Frees": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.Frees)
-			}},
-			"GCCPUFraction": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.GCCPUFraction)
-			}},
-			"GCSys": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.GCSys)
-			}},
-			"HeapAlloc": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.HeapAlloc)
-			}},
-			"HeapIdle": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.HeapIdle)
-			}},
-			"HeapInuse": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.HeapInuse)
-			}},
-			"HeapObjects": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.HeapObjects)
-			}},
-			"HeapReleased": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.HeapReleased)
-			}},
-			"HeapSys": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.HeapSys)
-			}},
-			"LastGC": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.LastGC)
-			}},
-			"Lookups": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.Lookups)
-			}},
-			"MCacheInuse": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.MCacheInuse)
-			}},
-			"MCacheSys": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.MCacheSys)
-			}},
-			"MSpanInuse": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.MSpanInuse)
-			}},
-			"MSpanSys": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.MSpanSys)
-			}},
-			"Mallocs": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.Mallocs)
-			}},
-			"NextGC": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.NextGC)
-			}},
-			"NumForcedGC": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.NumForcedGC)
-			}},
-			"NumGC": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.NumGC)
-			}},
-			"OtherSys": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.OtherSys)
-			}},
-			"PauseTotalNs": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.PauseTotalNs)
-			}},
-			"StackInuse": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.StackInuse)
-			}},
-			"StackSys": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.StackSys)
-			}},
-			"Sys": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.Sys)
-			}},
-			"TotalAlloc": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.RuntimeMemStat.TotalAlloc)
-			}},
-			"RandomValue": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(rand.Float64())
-			}},
-			"TotalMemory": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.GopsMemStat.Total)
-			}, source: GopsMetric},
-			"FreeMemory": {pullValue: func(sh *StatsHolder) gauge {
-				return gauge(sh.GopsMemStat.Free)
-			}, source: GopsMetric},
-		},
-		CounterDict: map[string]*CounterMetric{
-			"PollCount": {calculateNextValue: func(c *CounterMetric) counter {
-				nextVal := c.value + 1
-				return nextVal
-			}},
-		},
-		logger: logger,
+		GaugeDict:    map[string]*GaugeMetric{},
+		CounterDict:  map[string]*CounterMetric{},
+		aggregations: aggregations,
+		logger:       logger,
 	}
 
-	return &dict
-}
-
-// updateRuntimeMetrics обновление данных мониторинга runtime.MemStats метрик
-func (md *MetricsDics) updateRuntimeMetrics() {
-	md.mu.Lock()         // блокируем mutex
-	defer md.mu.Unlock() // разблокируем после обновления всех метрик
-
-	md.update(RuntimeMetric)
-}
-
-// updateGopsMetrics обновление данных мониторинга mem.VirtualMemoryStat метрик
-func (md *MetricsDics) updateGopsMetrics() {
-	md.mu.Lock()         // блокируем mutex
-	defer md.mu.Unlock() // разблокируем после обновления всех метрик
-
-	md.updateCPUMetrics() // обновляем метрики CPU
-	md.update(GopsMetric)
-}
-
-// updateCPUMetrics обновление данных по утилизации CPU
-func (md *MetricsDics) updateCPUMetrics() {
-	cpuStats, err := cpu.Percent(0, true)
+	rules, err := compileRelabelRules(relabel)
 	if err != nil {
-		md.logger.Error("getCPUsStats cpu.Percent error", err)
+		logger.Error("Invalid relabel rules, metrics aren't exported", err)
+		rules = []relabelRule{{action: agentconfig.RelabelExclude}}
 	}
+	dict.relabel = rules
 
-	for core, cpuPercent := range cpuStats {
-		metricName := fmt.Sprintf("CPUutilization%v", core)
-		md.GaugeDict[metricName] = &GaugeMetric{
-			source: CPUMetric,
-			value:  gauge(cpuPercent),
-			pullValue: func(sh *StatsHolder) gauge {
-				return gauge(0)
-			},
-		}
-	}
+	return &dict
 }
 
-// update обновление значений всех доступных метрик с учетом источника
-func (md *MetricsDics) update(metricType int) {
-	// получаем данные мониторинга
-	statsHolder := NewStatsHolder()
+// Store сохраняет метрики, полученные от источника.
+// gauge перезаписывается последним значением, к counter прибавляется Delta
+func (md *MetricsDics) Store(metrics []dto.Metrics) {
+	md.mu.Lock()         // блокируем mutex
+	defer md.mu.Unlock() // разблокируем после обновления всех метрик
 
-	// обновляем данные мониторинга по списку с учетом источника
-	for _, metric := range md.GaugeDict {
-		switch metricType {
-		case RuntimeMetric:
-			if metric.source != RuntimeMetric {
+	for _, metric := range metrics {
+		switch metric.MType {
+		case "gauge":
+			if metric.Value == nil {
+				continue
+			}
+			stored, ok := md.GaugeDict[metric.ID]
+			if !ok {
+				stored = &GaugeMetric{window: newGaugeWindow(metric.ID, md.aggregations)}
+				md.GaugeDict[metric.ID] = stored
+			}
+			stored.value = gauge(*metric.Value)
+			if stored.window != nil {
+				stored.window.add(*metric.Value)
+			}
+		case "counter":
+			if metric.Delta == nil {
 				continue
 			}
-			metric.value = metric.pullValue(statsHolder)
-		case GopsMetric:
-			if metric.source != GopsMetric {
+			if stored, ok := md.CounterDict[metric.ID]; ok {
+				stored.value += counter(*metric.Delta)
 				continue
 			}
-			metric.value = metric.pullValue(statsHolder)
+			md.CounterDict[metric.ID] = &CounterMetric{value: counter(*metric.Delta)}
+		default:
+			// непонятные метрики просто пропускаем
+			continue
 		}
 	}
-
-	for _, ct := range md.CounterDict {
-		ct.value = ct.calculateNextValue(ct)
-	}
 }
 
-// exportMetrics возвращает слайс DTO с подписанными метриками
+// exportMetrics возвращает слайс DTO с подписанными метриками, при sign == nil метрики не подписываются.
+// Агрегируемые gauge метрики заменяются агрегатами, окно агрегации при этом начинается заново.
+// Правила relabel применяются до подписи, подписывается итоговое имя метрики
 func (md *MetricsDics) exportMetrics(sign func(metricType, id string, delta *int64, value *float64) string) *[]dto.Metrics {
-	md.mu.RLock()         // берем mutex в режиме чтения
-	defer md.mu.RUnlock() // разблокируем после выполнения
+	md.mu.Lock()         // окна агрегации сбрасываются, поэтому mutex берется на запись
+	defer md.mu.Unlock() // разблокируем после выполнения
+
+	if sign == nil {
+		sign = func(string, string, *int64, *float64) string { return "" }
+	}
 
 	exportedData := make([]dto.Metrics, 0, len(md.GaugeDict)+len(md.CounterDict))
 
+	export := func(metric dto.Metrics) {
+		id, ok := relabel(md.relabel, metric.MType, metric.ID)
+		if !ok {
+			return
+		}
+		metric.ID = id
+		metric.Hash = sign(metric.MType, metric.ID, metric.Delta, metric.Value)
+		exportedData = append(exportedData, metric)
+	}
+
 	// выгружаем основные gauge метрики
 	for key, metric := range md.GaugeDict {
 		gaugeValue := metric.getGaugeValue()
-		exportedData = append(exportedData, dto.Metrics{
+		if metric.window != nil {
+			for _, aggregate := range metric.window.export(key, gaugeValue) {
+				export(aggregate)
+			}
+			continue
+		}
+		export(dto.Metrics{
 			ID:    key,
 			MType: "gauge",
-			Delta: nil,
 			Value: &gaugeValue,
-			Hash:  sign("gauge", key, nil, &gaugeValue),
 		})
 	}
 
 	// выгружаем основные counter метрики
 	for key, ct := range md.CounterDict {
 		counterValue := ct.getCounterValue()
-		exportedData = append(exportedData, dto.Metrics{
+		export(dto.Metrics{
 			ID:    key,
 			MType: "counter",
 			Delta: &counterValue,
-			Value: nil,
-			Hash:  sign("counter", key, &counterValue, nil),
 		})
 	}
 
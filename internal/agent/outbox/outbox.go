@@ -0,0 +1,200 @@
+// Package outbox - персистентная очередь пакетов метрик, которые не удалось отправить на сервер.
+// Пакеты хранятся в отдельных файлах каталога и воспроизводятся в порядке сбора.
+// Размер каталога ограничен, при превышении удаляются самые старые пакеты, они возвращаются вызывающему
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+// batchExt расширение файлов пакетов
+const batchExt = ".json"
+
+// Batch пакет метрик с временем сбора
+type Batch struct {
+	CollectedAt time.Time     `json:"collected_at"` // CollectedAt время сбора метрик, сохраняется при повторной отправке
+	Metrics     []dto.Metrics `json:"metrics"`      // Metrics подписанные метрики
+}
+
+// Entry пакет, сохраненный в очереди
+type Entry struct {
+	ID    string // ID имя файла пакета, используется для удаления после отправки
+	Batch Batch
+	size  int64
+}
+
+// Outbox очередь пакетов в каталоге dir с ограничением размера maxBytes.
+// Потокобезопасна, но рассчитана на один процесс агента
+type Outbox struct {
+	dir      string
+	maxBytes int64
+	entries  []Entry // entries пакеты в порядке сбора, метрики загружаются с диска при чтении
+	size     int64
+	seq      uint64
+	mu       sync.Mutex
+}
+
+// New открывает очередь в каталоге dir, создавая его при необходимости.
+// Ранее сохраненные пакеты остаются в очереди. maxBytes <= 0 - размер не ограничен
+func New(dir string, maxBytes int64) (*Outbox, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("outbox mkdir %v: %w", dir, err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("outbox read dir %v: %w", dir, err)
+	}
+
+	o := &Outbox{dir: dir, maxBytes: maxBytes}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), batchExt) {
+			continue
+		}
+		info, iErr := file.Info()
+		if iErr != nil {
+			continue
+		}
+		o.entries = append(o.entries, Entry{ID: file.Name(), size: info.Size()})
+		o.size += info.Size()
+	}
+
+	// имена файлов начинаются с времени сбора фиксированной длины, лексикографический порядок совпадает с порядком сбора
+	sort.Slice(o.entries, func(i, j int) bool { return o.entries[i].ID < o.entries[j].ID })
+
+	return o, nil
+}
+
+// Push сохраняет пакет в конец очереди. Если размер очереди превышен, удаляются самые старые пакеты,
+// они возвращаются в evicted, чтобы вызывающий мог учесть потерянные метрики.
+// Пакеты, которые не удалось прочитать при удалении, не возвращаются
+func (o *Outbox) Push(batch Batch) (evicted []Batch, err error) {
+	content, err := json.Marshal(batch)
+	if err != nil {
+		return nil, fmt.Errorf("outbox marshal: %w", err)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.seq++
+	id := fmt.Sprintf("%020d-%06d%v", batch.CollectedAt.UnixNano(), o.seq%1000000, batchExt)
+
+	tmp, err := os.CreateTemp(o.dir, ".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("outbox create: %w", err)
+	}
+	if _, err = tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return nil, fmt.Errorf("outbox write: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return nil, fmt.Errorf("outbox close: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), filepath.Join(o.dir, id)); err != nil {
+		_ = os.Remove(tmp.Name())
+		return nil, fmt.Errorf("outbox rename: %w", err)
+	}
+
+	entry := Entry{ID: id, size: int64(len(content))}
+	// пакет может быть собран раньше последнего сохраненного, вставляем с сохранением порядка
+	index := sort.Search(len(o.entries), func(i int) bool { return o.entries[i].ID > id })
+	o.entries = append(o.entries, Entry{})
+	copy(o.entries[index+1:], o.entries[index:])
+	o.entries[index] = entry
+	o.size += entry.size
+
+	return o.evict(), nil
+}
+
+// evict удаляет самые старые пакеты, пока размер очереди больше maxBytes, и возвращает их
+func (o *Outbox) evict() []Batch {
+	var evicted []Batch
+	for o.maxBytes > 0 && o.size > o.maxBytes && len(o.entries) > 0 {
+		oldest := o.entries[0]
+		if batch, err := o.read(oldest.ID); err == nil {
+			evicted = append(evicted, batch)
+		}
+		_ = os.Remove(filepath.Join(o.dir, oldest.ID))
+		o.entries = o.entries[1:]
+		o.size -= oldest.size
+	}
+	return evicted
+}
+
+// read загружает пакет id с диска
+func (o *Outbox) read(id string) (Batch, error) {
+	var batch Batch
+	content, err := os.ReadFile(filepath.Join(o.dir, id))
+	if err == nil {
+		err = json.Unmarshal(content, &batch)
+	}
+	return batch, err
+}
+
+// Peek возвращает самый старый пакет без удаления из очереди. ok = false, если очередь пуста.
+// Поврежденный файл пакета удаляется из очереди, возвращается ошибка
+func (o *Outbox) Peek() (entry Entry, ok bool, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.entries) == 0 {
+		return Entry{}, false, nil
+	}
+
+	entry = o.entries[0]
+	if entry.Batch, err = o.read(entry.ID); err != nil {
+		o.remove(entry.ID)
+		return Entry{}, false, fmt.Errorf("outbox read %v: %w", entry.ID, err)
+	}
+
+	return entry, true, nil
+}
+
+// Remove удаляет отправленный пакет из очереди
+func (o *Outbox) Remove(id string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.remove(id)
+}
+
+// remove удаляет пакет из очереди и с диска, вызывается под блокировкой
+func (o *Outbox) remove(id string) {
+	for i, entry := range o.entries {
+		if entry.ID != id {
+			continue
+		}
+		_ = os.Remove(filepath.Join(o.dir, id))
+		o.entries = append(o.entries[:i], o.entries[i+1:]...)
+		o.size -= entry.size
+		return
+	}
+}
+
+// Len количество пакетов в очереди
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return len(o.entries)
+}
+
+// Size суммарный размер пакетов в очереди в байтах
+func (o *Outbox) Size() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.size
+}
@@ -0,0 +1,61 @@
+package outbox
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+func TestOutbox(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	batch := func(offset time.Duration, id string) Batch {
+		value := 1.0
+		return Batch{CollectedAt: start.Add(offset), Metrics: []dto.Metrics{{ID: id, MType: "gauge", Value: &value}}}
+	}
+
+	box, err := New(dir, 0)
+	require.NoError(t, err)
+	for _, b := range []Batch{batch(2*time.Second, "second"), batch(time.Second, "first"), batch(3*time.Second, "third")} {
+		evicted, pErr := box.Push(b)
+		require.NoError(t, pErr)
+		assert.Empty(t, evicted)
+	}
+	assert.Equal(t, 3, box.Len())
+
+	// пакеты сохраняются между перезапусками и отдаются в порядке сбора
+	box, err = New(dir, 0)
+	require.NoError(t, err)
+	require.Equal(t, 3, box.Len())
+
+	entry, ok, err := box.Peek()
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "first", entry.Batch.Metrics[0].ID)
+	assert.True(t, start.Add(time.Second).Equal(entry.Batch.CollectedAt))
+	box.Remove(entry.ID)
+
+	entry, ok, err = box.Peek()
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "second", entry.Batch.Metrics[0].ID)
+
+	// при превышении размера удаляются самые старые пакеты, они возвращаются вызывающему
+	limited, err := New(dir, box.Size())
+	require.NoError(t, err)
+	evicted, err := limited.Push(batch(4*time.Second, "fourth"))
+	require.NoError(t, err)
+	require.Len(t, evicted, 1)
+	assert.Equal(t, "second", evicted[0].Metrics[0].ID)
+	assert.Equal(t, 2, limited.Len())
+
+	entry, ok, err = limited.Peek()
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "third", entry.Batch.Metrics[0].ID)
+}
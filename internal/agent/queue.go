@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"context"
+	"sync"
+
+	"github.com/atrian/devmetrics/internal/agent/outbox"
+)
+
+// Политики переполнения очереди отправки
+const (
+	OverflowDropOldest = "drop_oldest" // OverflowDropOldest из очереди удаляется самый старый пакет
+	OverflowDropNewest = "drop_newest" // OverflowDropNewest новый пакет отбрасывается
+	OverflowBlock      = "block"       // OverflowBlock добавление пакета ждет освобождения места
+)
+
+// uploadQueue ограниченная очередь пакетов, ожидающих отправки воркерами
+type uploadQueue struct {
+	jobs   chan outbox.Batch
+	policy string
+	mu     sync.Mutex // mu делает атомарной замену самого старого пакета при drop_oldest
+}
+
+// newUploadQueue возвращает очередь на size пакетов с политикой переполнения policy.
+// Неизвестная политика считается drop_oldest
+func newUploadQueue(size int, policy string) *uploadQueue {
+	if size < 1 {
+		size = 1
+	}
+	if policy != OverflowDropNewest && policy != OverflowBlock {
+		policy = OverflowDropOldest
+	}
+
+	return &uploadQueue{
+		jobs:   make(chan outbox.Batch, size),
+		policy: policy,
+	}
+}
+
+// Push добавляет пакет в очередь по политике переполнения.
+// Возвращает количество метрик в отброшенном пакете, 0 - ничего не отброшено.
+// При политике block ожидание прерывается завершением контекста, новый пакет при этом отбрасывается
+func (q *uploadQueue) Push(ctx context.Context, batch outbox.Batch) int {
+	switch q.policy {
+	case OverflowBlock:
+		select {
+		case q.jobs <- batch:
+			return 0
+		case <-ctx.Done():
+			return len(batch.Metrics)
+		}
+	case OverflowDropNewest:
+		select {
+		case q.jobs <- batch:
+			return 0
+		default:
+			return len(batch.Metrics)
+		}
+	default:
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		dropped := 0
+		for {
+			select {
+			case q.jobs <- batch:
+				return dropped
+			default:
+			}
+
+			select {
+			case oldest := <-q.jobs:
+				dropped += len(oldest.Metrics)
+			default:
+			}
+		}
+	}
+}
+
+// Jobs канал пакетов для воркеров, закрывается методом Close
+func (q *uploadQueue) Jobs() <-chan outbox.Batch {
+	return q.jobs
+}
+
+// Len количество пакетов в очереди
+func (q *uploadQueue) Len() int {
+	return len(q.jobs)
+}
+
+// Close закрывает очередь, воркеры отправляют оставшиеся пакеты и завершаются
+func (q *uploadQueue) Close() {
+	close(q.jobs)
+}
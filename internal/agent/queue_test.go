@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atrian/devmetrics/internal/agent/outbox"
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+func TestUploadQueue_Push(t *testing.T) {
+	batch := func(id string) outbox.Batch {
+		return outbox.Batch{Metrics: []dto.Metrics{{ID: id}}}
+	}
+
+	t.Run("Drop oldest", func(t *testing.T) {
+		q := newUploadQueue(2, OverflowDropOldest)
+		assert.Equal(t, 0, q.Push(context.Background(), batch("first")))
+		assert.Equal(t, 0, q.Push(context.Background(), batch("second")))
+		assert.Equal(t, 1, q.Push(context.Background(), batch("third")))
+
+		assert.Equal(t, "second", (<-q.Jobs()).Metrics[0].ID)
+		assert.Equal(t, "third", (<-q.Jobs()).Metrics[0].ID)
+	})
+
+	t.Run("Drop newest", func(t *testing.T) {
+		q := newUploadQueue(1, OverflowDropNewest)
+		assert.Equal(t, 0, q.Push(context.Background(), batch("first")))
+		assert.Equal(t, 1, q.Push(context.Background(), batch("second")))
+
+		assert.Equal(t, "first", (<-q.Jobs()).Metrics[0].ID)
+		assert.Equal(t, 0, q.Len())
+	})
+
+	t.Run("Block", func(t *testing.T) {
+		q := newUploadQueue(1, OverflowBlock)
+		assert.Equal(t, 0, q.Push(context.Background(), batch("first")))
+
+		done := make(chan int)
+		go func() {
+			done <- q.Push(context.Background(), batch("second"))
+		}()
+
+		select {
+		case <-done:
+			t.Fatal("Push must block while the queue is full")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		assert.Equal(t, "first", (<-q.Jobs()).Metrics[0].ID)
+		assert.Equal(t, 0, <-done)
+
+		// ожидание прерывается завершением контекста
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.Equal(t, 1, q.Push(ctx, batch("third")))
+	})
+
+	t.Run("Unknown policy", func(t *testing.T) {
+		assert.Equal(t, OverflowDropOldest, newUploadQueue(1, "random").policy)
+	})
+}
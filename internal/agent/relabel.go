@@ -0,0 +1,73 @@
+package agent
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/atrian/devmetrics/internal/appconfig/agentconfig"
+)
+
+// relabelRule скомпилированное правило фильтрации и переименования
+type relabelRule struct {
+	action      string
+	regex       *regexp.Regexp // regex nil - правило применяется ко всем метрикам
+	replacement string
+	prefix      string
+	metricType  string
+}
+
+// compileRelabelRules проверяет и компилирует правила в порядке применения.
+// Выражения проверяются на совпадение со всем именем метрики
+func compileRelabelRules(configs []agentconfig.RelabelConfig) ([]relabelRule, error) {
+	rules := make([]relabelRule, 0, len(configs))
+
+	for i, config := range configs {
+		regex, err := config.Compile()
+		if err != nil {
+			return nil, fmt.Errorf("relabel rule %d: %w", i, err)
+		}
+
+		rules = append(rules, relabelRule{
+			action:      config.Action,
+			regex:       regex,
+			replacement: config.Replacement,
+			prefix:      config.Prefix,
+			metricType:  config.Type,
+		})
+	}
+
+	return rules, nil
+}
+
+// relabel применяет правила по порядку к метрике типа metricType с именем id.
+// Возвращает новое имя и false, если метрика должна быть удалена
+func relabel(rules []relabelRule, metricType, id string) (string, bool) {
+	for _, rule := range rules {
+		matched := rule.regex == nil || rule.regex.MatchString(id)
+
+		switch rule.action {
+		case agentconfig.RelabelInclude:
+			if !matched {
+				return "", false
+			}
+		case agentconfig.RelabelExclude:
+			if matched {
+				return "", false
+			}
+		case agentconfig.RelabelRename:
+			if matched {
+				id = rule.regex.ReplaceAllString(id, rule.replacement)
+			}
+		case agentconfig.RelabelPrefix:
+			if matched {
+				id = rule.prefix + id
+			}
+		case agentconfig.RelabelDropType:
+			if matched && metricType == rule.metricType {
+				return "", false
+			}
+		}
+	}
+
+	return id, id != ""
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atrian/devmetrics/internal/appconfig/agentconfig"
+	"github.com/atrian/devmetrics/internal/dto"
+	"github.com/atrian/devmetrics/pkg/logger"
+)
+
+func Test_relabel(t *testing.T) {
+	rules, err := compileRelabelRules([]agentconfig.RelabelConfig{
+		{Action: agentconfig.RelabelExclude, Regex: `CPUutilization\d+`},
+		{Action: agentconfig.RelabelDropType, Regex: `Poll.*`, Type: "counter"},
+		{Action: agentconfig.RelabelRename, Regex: `Heap(?P<kind>\w+)`, Replacement: "MemHeap_${kind}"},
+		{Action: agentconfig.RelabelInclude, Regex: `MemHeap_.*|CPU.*|Poll.*`},
+		{Action: agentconfig.RelabelPrefix, Prefix: "host1_"},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		metricType string
+		id         string
+		want       string
+		keep       bool
+	}{
+		{name: "excluded", metricType: "gauge", id: "CPUutilization3", keep: false},
+		{name: "total is kept", metricType: "gauge", id: "CPUutilizationTotal", want: "host1_CPUutilizationTotal", keep: true},
+		{name: "counter dropped by type", metricType: "counter", id: "PollCount", keep: false},
+		{name: "gauge not dropped by type", metricType: "gauge", id: "PollInterval", want: "host1_PollInterval", keep: true},
+		{name: "renamed", metricType: "gauge", id: "HeapAlloc", want: "host1_MemHeap_Alloc", keep: true},
+		{name: "not included", metricType: "gauge", id: "Alloc", keep: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, keep := relabel(rules, tt.metricType, tt.id)
+			assert.Equal(t, tt.keep, keep)
+			if tt.keep {
+				assert.Equal(t, tt.want, id)
+			}
+		})
+	}
+}
+
+func Test_compileRelabelRules_Invalid(t *testing.T) {
+	invalid := []agentconfig.RelabelConfig{
+		{Action: "keep", Regex: "Alloc"},
+		{Action: agentconfig.RelabelExclude},
+		{Action: agentconfig.RelabelInclude, Regex: "("},
+		{Action: agentconfig.RelabelPrefix},
+		{Action: agentconfig.RelabelDropType, Type: "histogram"},
+	}
+	for _, rule := range invalid {
+		_, err := compileRelabelRules([]agentconfig.RelabelConfig{rule})
+		assert.Error(t, err, rule.Action)
+	}
+}
+
+func TestMetricsDics_exportMetrics_Relabel(t *testing.T) {
+	md := NewMetricsDicts(logger.NewZapLogger(), nil, []agentconfig.RelabelConfig{
+		{Action: agentconfig.RelabelRename, Regex: `(\w+)Alloc`, Replacement: "Alloc_${1}"},
+		{Action: agentconfig.RelabelDropType, Type: "counter"},
+	})
+
+	value := 1.5
+	delta := int64(1)
+	md.Store([]dto.Metrics{
+		{ID: "HeapAlloc", MType: "gauge", Value: &value},
+		{ID: "PollCount", MType: "counter", Delta: &delta},
+	})
+
+	var signed []string
+	exported := *md.exportMetrics(func(metricType, id string, delta *int64, value *float64) string {
+		signed = append(signed, id)
+		return "hash"
+	})
+
+	require.Len(t, exported, 1)
+	assert.Equal(t, "Alloc_Heap", exported[0].ID)
+	assert.Equal(t, "hash", exported[0].Hash)
+	// подписывается только отправляемая метрика с итоговым именем
+	assert.Equal(t, []string{"Alloc_Heap"}, signed)
+}
+
+func TestMetricsDics_exportMetrics_InvalidRelabel(t *testing.T) {
+	// некорректное правило удаления не должно приводить к отправке всех метрик
+	md := NewMetricsDicts(logger.NewZapLogger(), nil, []agentconfig.RelabelConfig{
+		{Action: agentconfig.RelabelExclude, Regex: "Heap("},
+	})
+
+	value := 1.5
+	md.Store([]dto.Metrics{{ID: "HeapAlloc", MType: "gauge", Value: &value}})
+	assert.Empty(t, *md.exportMetrics(nil))
+}
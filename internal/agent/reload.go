@@ -0,0 +1,124 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/atrian/devmetrics/internal/appconfig/agentconfig"
+	"github.com/atrian/devmetrics/pkg/logger"
+)
+
+// Reload перечитывает конфигурацию агента из JSON, флагов и переменных окружения.
+// Новая конфигурация проверяется целиком, затем одновременно заменяются интервалы опроса и отправки
+// и серверы отправки вместе с ключами подписи и шифрования. Накопленные метрики сохраняются.
+// При ошибке возвращается причина, агент продолжает работать с текущей конфигурацией.
+// Состав источников метрик, агрегации и правила relabel применяются только при запуске агента
+func (a *Agent) Reload(ctx context.Context) error {
+	config, err := agentconfig.Reload(a.logger)
+	if err != nil {
+		return err
+	}
+
+	destinations, err := a.newDestinations(config)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	config.Agent.AgentIP = a.config.Agent.AgentIP
+	previous := a.destinations
+	shareState(previous, destinations, a.config.Agent.OutboxDir == config.Agent.OutboxDir)
+	a.config = config
+	a.destinations = destinations
+	close(a.reloaded)
+	a.reloaded = make(chan struct{})
+	a.mu.Unlock()
+
+	// пакеты из очередей прежних серверов отправляются с прежними ключами до запуска новых воркеров,
+	// чтобы очереди outbox с одним каталогом не обрабатывались одновременно
+	stopDestinations(previous, a.logger)
+	for _, d := range destinations {
+		d.run(ctx, config.Agent.RateLimit, config.Agent.HealthCheckInterval, a.logger)
+	}
+
+	a.logger.Info(fmt.Sprintf("Configuration reloaded. PollInterval: %v, ReportInterval: %v, Destinations: %v",
+		config.Agent.PollInterval, config.Agent.ReportInterval, len(destinations)))
+	return nil
+}
+
+// newDestinations подготавливает серверы отправки из конфигурации config.
+// При ошибке уже подготовленные серверы закрываются
+func (a *Agent) newDestinations(config *agentconfig.Config) ([]*destination, error) {
+	if policy := newUploadQueue(1, config.Agent.OverflowPolicy).policy; policy != config.Agent.OverflowPolicy {
+		a.logger.Warning(fmt.Sprintf("Unknown upload overflow policy %q, %v is used", config.Agent.OverflowPolicy, policy))
+	}
+
+	var destinations []*destination
+	for _, destinationConfig := range config.UploadDestinations() {
+		d, err := newDestination(config, destinationConfig, a.metrics, a.logger)
+		if err != nil {
+			for _, prepared := range destinations {
+				_ = prepared.uploader.Close()
+			}
+			return nil, err
+		}
+
+		destinations = append(destinations, d)
+		target := destinationConfig.Address
+		if destinationConfig.Protocol == agentconfig.SinkFile {
+			target = destinationConfig.Path
+		}
+		a.logger.Info(fmt.Sprintf("Destination %v: %v %v", destinationConfig.Name,
+			strings.ToUpper(destinationConfig.Protocol), target))
+	}
+
+	return destinations, nil
+}
+
+// shareState передает новым серверам учет отправленных счетчиков прежних серверов с тем же именем,
+// чтобы сервер не получил накопленные значения повторно. Если каталог очередей не изменился, передаются
+// и очереди outbox, чтобы пакеты, сохраненные во время остановки прежних серверов, не потерялись из индекса очереди
+func shareState(previous, destinations []*destination, sameOutboxDir bool) {
+	for _, d := range destinations {
+		for _, p := range previous {
+			if p.uploader.Name() != d.uploader.Name() {
+				continue
+			}
+			d.uploader.counters = p.uploader.counters
+			if sameOutboxDir && p.uploader.outbox != nil {
+				d.uploader.outbox = p.uploader.outbox
+			}
+		}
+	}
+}
+
+// stopDestinations останавливает серверы отправки параллельно и дожидается отправки их очередей
+func stopDestinations(destinations []*destination, logger logger.Logger) {
+	var wg sync.WaitGroup
+	for _, d := range destinations {
+		wg.Add(1)
+		go func(d *destination) {
+			defer wg.Done()
+			d.stop(logger)
+		}(d)
+	}
+	wg.Wait()
+}
+
+// currentConfig текущая конфигурация агента
+func (a *Agent) currentConfig() *agentconfig.Config {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.config
+}
+
+// reloadNotify канал, который закроется при следующей перезагрузке конфигурации
+func (a *Agent) reloadNotify() <-chan struct{} {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.reloaded
+}
@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atrian/devmetrics/internal/appconfig/agentconfig"
+	"github.com/atrian/devmetrics/internal/dto"
+	"github.com/atrian/devmetrics/pkg/logger"
+)
+
+func TestAgent_Reload(t *testing.T) {
+	received := make(chan string, 4)
+	newServer := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received <- name
+		}))
+	}
+	before := newServer("before")
+	defer before.Close()
+	after := newServer("after")
+	defer after.Close()
+
+	configFile := filepath.Join(t.TempDir(), "agent.json")
+	writeConfig := func(content string) {
+		require.NoError(t, os.WriteFile(configFile, []byte(content), 0o600))
+	}
+	t.Setenv("CONFIG", configFile)
+	t.Setenv("AGENT_ID", "reload-test")
+
+	agentLogger := logger.NewZapLogger()
+	writeConfig(`{"address": "` + strings.TrimPrefix(before.URL, "http://") + `", "report_interval": "1s", "poll_interval": "1s"}`)
+	config, err := agentconfig.Reload(agentLogger)
+	require.NoError(t, err)
+
+	a := &Agent{
+		config:   config,
+		metrics:  NewMetricsDicts(agentLogger, nil, nil),
+		reloaded: make(chan struct{}),
+		logger:   agentLogger,
+	}
+	a.destinations, err = a.newDestinations(config)
+	require.NoError(t, err)
+	for _, d := range a.destinations {
+		d.run(context.Background(), 1, 0, agentLogger)
+	}
+
+	value := 1.0
+	a.metrics.Store([]dto.Metrics{{ID: "Alloc", MType: "gauge", Value: &value}})
+	a.UploadStats(context.Background())
+	assert.Equal(t, "before", waitReceived(t, received))
+
+	// некорректная конфигурация - продолжает работать текущая
+	notify := a.reloadNotify()
+	writeConfig(`{"address": "` + strings.TrimPrefix(after.URL, "http://") + `", "report_interval": "-1s"}`)
+	assert.Error(t, a.Reload(context.Background()))
+	assert.Same(t, config, a.currentConfig())
+
+	// некорректные правила relabel также не применяются
+	writeConfig(`{"address": "` + strings.TrimPrefix(after.URL, "http://") + `", "relabel": [{"action": "exclude", "regex": "Heap("}]}`)
+	assert.Error(t, a.Reload(context.Background()))
+	assert.Same(t, config, a.currentConfig())
+
+	// корректная конфигурация - интервалы и сервер заменяются
+	writeConfig(`{"address": "` + strings.TrimPrefix(after.URL, "http://") + `", "report_interval": "5s", "poll_interval": "3s"}`)
+	require.NoError(t, a.Reload(context.Background()))
+	assert.Equal(t, 5*time.Second, a.currentConfig().Agent.ReportInterval)
+	assert.Equal(t, 3*time.Second, a.currentConfig().Agent.PollInterval)
+
+	select {
+	case <-notify:
+	default:
+		t.Fatal("reload notification wasn't sent")
+	}
+
+	a.UploadStats(context.Background())
+	assert.Equal(t, "after", waitReceived(t, received))
+}
+
+// waitReceived ждет имя сервера, получившего пакет
+func waitReceived(t *testing.T, received <-chan string) string {
+	t.Helper()
+
+	select {
+	case name := <-received:
+		return name
+	case <-time.After(time.Second):
+		t.Fatal("batch wasn't received")
+		return ""
+	}
+}
@@ -0,0 +1,149 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/atrian/devmetrics/internal/appconfig/agentconfig"
+)
+
+// UploadError результат неудачной отправки пакета
+type UploadError struct {
+	Err       error // Err ошибка последней попытки
+	Attempts  int   // Attempts количество выполненных попыток
+	Permanent bool  // Permanent повтор отправки не поможет, пакет отбрасывается
+}
+
+// Error текст ошибки
+func (e *UploadError) Error() string {
+	kind := "retryable"
+	if e.Permanent {
+		kind = "permanent"
+	}
+	return fmt.Sprintf("upload failed after %d attempts (%v): %v", e.Attempts, kind, e.Err)
+}
+
+// Unwrap исходная ошибка
+func (e *UploadError) Unwrap() error {
+	return e.Err
+}
+
+// statusError ответ HTTP сервера с кодом, отличным от 2xx
+type statusError struct {
+	code int
+}
+
+// Error текст ошибки
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status %d %v", e.code, http.StatusText(e.code))
+}
+
+// permanentError ошибка, которую нельзя исправить повтором, например ошибка маршалинга или шифрования
+type permanentError struct {
+	err error
+}
+
+// Error текст ошибки
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap исходная ошибка
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// isRetryable проверяет, имеет ли смысл повторить отправку после ошибки err.
+// Повторяются сетевые ошибки, ответы 5xx, 408, 429 и GRPC коды Unavailable, DeadlineExceeded, ResourceExhausted,
+// Aborted, а также Internal и Unknown как аналоги 5xx.
+// Остальные ответы сервера (400, 403, InvalidArgument и т.д.) считаются окончательными
+func isRetryable(err error) bool {
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+
+	var httpStatus *statusError
+	if errors.As(err, &httpStatus) {
+		return httpStatus.code >= 500 || httpStatus.code == http.StatusTooManyRequests || httpStatus.code == http.StatusRequestTimeout
+	}
+
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &grpcErr) {
+		switch grpcErr.GRPCStatus().Code() {
+		case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted, codes.Internal, codes.Unknown:
+			return true
+		default:
+			return false
+		}
+	}
+
+	// сетевые ошибки и ошибки без кода ответа
+	return true
+}
+
+// withRetry выполняет send, повторяя попытки после временных ошибок по политике policy.
+// Пауза между попытками растет экспоненциально от InitialBackoff до MaxBackoff, к ней добавляется случайное отклонение Jitter.
+// Все попытки ограничены общим временем Deadline
+func withRetry(ctx context.Context, policy agentconfig.RetryConfig, send func(ctx context.Context) error) error {
+	if policy.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, policy.Deadline)
+		defer cancel()
+	}
+
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = send(ctx); err == nil {
+			return nil
+		}
+
+		if !isRetryable(err) {
+			return &UploadError{Err: err, Attempts: attempt, Permanent: true}
+		}
+		if attempt >= maxAttempts {
+			return &UploadError{Err: err, Attempts: attempt}
+		}
+
+		timer := time.NewTimer(backoff(policy, attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return &UploadError{Err: err, Attempts: attempt}
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff пауза перед повтором после попытки attempt
+func backoff(policy agentconfig.RetryConfig, attempt int) time.Duration {
+	delay := policy.InitialBackoff
+	for i := 1; i < attempt && (policy.MaxBackoff <= 0 || delay < policy.MaxBackoff); i++ {
+		delay *= 2
+	}
+	if policy.MaxBackoff > 0 && delay > policy.MaxBackoff {
+		delay = policy.MaxBackoff
+	}
+
+	if policy.Jitter > 0 {
+		// случайное отклонение в пределах ±Jitter от паузы, чтобы агенты не повторяли запросы одновременно
+		delay += time.Duration((rand.Float64()*2 - 1) * policy.Jitter * float64(delay))
+	}
+	if delay < 0 {
+		delay = 0
+	}
+
+	return delay
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/atrian/devmetrics/internal/appconfig/agentconfig"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tt := []struct {
+		testName  string
+		err       error
+		retryable bool
+	}{
+		{"Network error", errors.New("connection refused"), true},
+		{"HTTP 503", &statusError{code: http.StatusServiceUnavailable}, true},
+		{"HTTP 429", &statusError{code: http.StatusTooManyRequests}, true},
+		{"HTTP 400", &statusError{code: http.StatusBadRequest}, false},
+		{"HTTP 403", &statusError{code: http.StatusForbidden}, false},
+		{"GRPC Unavailable", fmt.Errorf("wrapped: %w", status.Error(codes.Unavailable, "down")), true},
+		{"GRPC InvalidArgument", fmt.Errorf("wrapped: %w", status.Error(codes.InvalidArgument, "bad")), false},
+		{"Encryption error", &permanentError{err: errors.New("bad key")}, false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.testName, func(t *testing.T) {
+			assert.Equal(t, tc.retryable, isRetryable(tc.err))
+		})
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	policy := agentconfig.RetryConfig{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     2 * time.Millisecond,
+		Jitter:         0.5,
+		Deadline:       time.Second,
+	}
+
+	t.Run("Success after retryable errors", func(t *testing.T) {
+		attempts := 0
+		err := withRetry(context.Background(), policy, func(ctx context.Context) error {
+			attempts++
+			if attempts < 3 {
+				return &statusError{code: http.StatusBadGateway}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("Attempts exhausted", func(t *testing.T) {
+		err := withRetry(context.Background(), policy, func(ctx context.Context) error {
+			return &statusError{code: http.StatusBadGateway}
+		})
+		var uploadErr *UploadError
+		require.ErrorAs(t, err, &uploadErr)
+		assert.Equal(t, 3, uploadErr.Attempts)
+		assert.False(t, uploadErr.Permanent)
+	})
+
+	t.Run("Permanent error is not retried", func(t *testing.T) {
+		err := withRetry(context.Background(), policy, func(ctx context.Context) error {
+			return &statusError{code: http.StatusBadRequest}
+		})
+		var uploadErr *UploadError
+		require.ErrorAs(t, err, &uploadErr)
+		assert.Equal(t, 1, uploadErr.Attempts)
+		assert.True(t, uploadErr.Permanent)
+	})
+
+	t.Run("Deadline stops retries", func(t *testing.T) {
+		slow := policy
+		slow.MaxAttempts = 100
+		slow.InitialBackoff = time.Hour
+		slow.MaxBackoff = time.Hour
+		slow.Deadline = 10 * time.Millisecond
+
+		err := withRetry(context.Background(), slow, func(ctx context.Context) error {
+			return errors.New("connection refused")
+		})
+		var uploadErr *UploadError
+		require.ErrorAs(t, err, &uploadErr)
+		assert.Equal(t, 1, uploadErr.Attempts)
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	policy := agentconfig.RetryConfig{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	assert.Equal(t, 100*time.Millisecond, backoff(policy, 1))
+	assert.Equal(t, 400*time.Millisecond, backoff(policy, 3))
+	assert.Equal(t, time.Second, backoff(policy, 10))
+
+	policy.Jitter = 0.2
+	for i := 0; i < 100; i++ {
+		delay := backoff(policy, 1)
+		assert.GreaterOrEqual(t, delay, 80*time.Millisecond)
+		assert.LessOrEqual(t, delay, 120*time.Millisecond)
+	}
+}
@@ -0,0 +1,210 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/atrian/devmetrics/internal/agent/outbox"
+	"github.com/atrian/devmetrics/internal/appconfig/agentconfig"
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+// Ротация NDJSON файла по умолчанию
+const (
+	defaultSinkMaxSize    = 10 << 20 // defaultSinkMaxSize размер файла, после которого он ротируется
+	defaultSinkMaxBackups = 3        // defaultSinkMaxBackups количество хранимых ротированных файлов
+)
+
+// sink локальный вывод пакетов метрик вместо отправки на сервер
+type sink interface {
+	Write(batch outbox.Batch) error // Write выводит пакет метрик
+	Close() error                   // Close освобождает ресурсы вывода
+}
+
+// sinkRecord строка JSON вывода: метрика со временем сбора и идентификатором агента
+type sinkRecord struct {
+	CollectedAt time.Time `json:"collected_at"`
+	AgentID     string    `json:"agent_id,omitempty"`
+	dto.Metrics
+}
+
+// newSink возвращает локальный вывод для протоколов stdout и file, для остальных протоколов - nil.
+// В JSON вывод добавляется идентификатор агента agentID
+func newSink(destination agentconfig.DestinationConfig, agentID string) (sink, error) {
+	switch destination.Protocol {
+	case agentconfig.SinkStdout:
+		return &writerSink{w: os.Stdout, json: destination.Format == "json", agentID: agentID}, nil
+	case agentconfig.SinkFile:
+		s, err := newFileSink(destination.Path, destination.MaxSize, destination.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		s.agentID = agentID
+		return s, nil
+	default:
+		return nil, nil
+	}
+}
+
+// sortedMetrics копия пакета, отсортированная по типу и имени метрики, для удобного чтения вывода
+func sortedMetrics(metrics []dto.Metrics) []dto.Metrics {
+	sorted := append([]dto.Metrics(nil), metrics...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].MType != sorted[j].MType {
+			return sorted[i].MType < sorted[j].MType
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+	return sorted
+}
+
+// encodeRecords JSON объект на строку для каждой метрики пакета
+func encodeRecords(batch outbox.Batch, agentID string) ([]byte, error) {
+	var data []byte
+	for _, metric := range sortedMetrics(batch.Metrics) {
+		line, err := json.Marshal(sinkRecord{CollectedAt: batch.CollectedAt, AgentID: agentID, Metrics: metric})
+		if err != nil {
+			return nil, err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	return data, nil
+}
+
+// writerSink вывод в поток w: читаемая таблица или JSON объект на строку
+type writerSink struct {
+	w       io.Writer
+	json    bool
+	agentID string
+	mu      sync.Mutex
+}
+
+// Write выводит пакет метрик
+func (s *writerSink) Write(batch outbox.Batch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.json {
+		data, err := encodeRecords(batch, s.agentID)
+		if err != nil {
+			return &permanentError{err: fmt.Errorf("encode metrics: %w", err)}
+		}
+		_, err = s.w.Write(data)
+		return err
+	}
+
+	w := bufio.NewWriter(s.w)
+	fmt.Fprintf(w, "# %v, %d metrics\n", batch.CollectedAt.Format(time.RFC3339), len(batch.Metrics))
+	for _, metric := range sortedMetrics(batch.Metrics) {
+		switch {
+		case metric.Value != nil:
+			fmt.Fprintf(w, "%-8s %-40s %v\n", metric.MType, metric.ID, *metric.Value)
+		case metric.Delta != nil:
+			fmt.Fprintf(w, "%-8s %-40s %v\n", metric.MType, metric.ID, *metric.Delta)
+		}
+	}
+	return w.Flush()
+}
+
+// Close стандартный вывод не закрывается
+func (s *writerSink) Close() error {
+	return nil
+}
+
+// fileSink дозапись пакетов в NDJSON файл. Когда размер файла превышает maxSize, он переименовывается в <path>.1,
+// прежние ротированные файлы сдвигаются, файлы старше maxBackups удаляются
+type fileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	agentID    string
+	file       *os.File
+	size       int64
+	mu         sync.Mutex
+}
+
+// newFileSink открывает файл path на дозапись, при нулевых maxSize и maxBackups используются значения по умолчанию
+func newFileSink(path string, maxSize int64, maxBackups int) (*fileSink, error) {
+	if maxSize <= 0 {
+		maxSize = defaultSinkMaxSize
+	}
+	if maxBackups <= 0 {
+		maxBackups = defaultSinkMaxBackups
+	}
+
+	s := &fileSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// open открывает файл на дозапись и запоминает его размер
+func (s *fileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open sink file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("stat sink file: %w", err)
+	}
+
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// Write дописывает пакет в файл, перед записью файл ротируется, если превысит maxSize
+func (s *fileSink) Write(batch outbox.Batch) error {
+	data, err := encodeRecords(batch, s.agentID)
+	if err != nil {
+		return &permanentError{err: fmt.Errorf("encode metrics: %w", err)}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size > 0 && s.size+int64(len(data)) > s.maxSize {
+		if err = s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(data)
+	s.size += int64(n)
+	return err
+}
+
+// rotate закрывает текущий файл, сдвигает ротированные файлы и открывает новый
+func (s *fileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("close sink file: %w", err)
+	}
+
+	_ = os.Remove(fmt.Sprintf("%s.%d", s.path, s.maxBackups))
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+	}
+	if err := os.Rename(s.path, s.path+".1"); err != nil {
+		return fmt.Errorf("rotate sink file: %w", err)
+	}
+
+	return s.open()
+}
+
+// Close закрывает файл
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
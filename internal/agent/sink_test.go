@@ -0,0 +1,161 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atrian/devmetrics/internal/agent/collector"
+	"github.com/atrian/devmetrics/internal/agent/outbox"
+	"github.com/atrian/devmetrics/internal/appconfig/agentconfig"
+	"github.com/atrian/devmetrics/internal/dto"
+	"github.com/atrian/devmetrics/pkg/logger"
+)
+
+// sinkBatch пакет из gauge и counter метрики
+func sinkBatch() outbox.Batch {
+	value := 1.5
+	delta := int64(3)
+	return outbox.Batch{
+		CollectedAt: time.Date(2022, 12, 1, 10, 0, 0, 0, time.UTC),
+		Metrics: []dto.Metrics{
+			{ID: "PollCount", MType: "counter", Delta: &delta},
+			{ID: "Alloc", MType: "gauge", Value: &value},
+		},
+	}
+}
+
+func TestWriterSink_Write(t *testing.T) {
+	var pretty bytes.Buffer
+	require.NoError(t, (&writerSink{w: &pretty}).Write(sinkBatch()))
+	lines := strings.Split(strings.TrimSpace(pretty.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, "# 2022-12-01T10:00:00Z, 2 metrics", lines[0])
+	assert.Equal(t, []string{"counter", "PollCount", "3"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"gauge", "Alloc", "1.5"}, strings.Fields(lines[2]))
+
+	var ndjson bytes.Buffer
+	require.NoError(t, (&writerSink{w: &ndjson, json: true, agentID: "host-1"}).Write(sinkBatch()))
+	records := readRecords(t, &ndjson)
+	require.Len(t, records, 2)
+	assert.Equal(t, "PollCount", records[0].ID)
+	assert.Equal(t, int64(3), *records[0].Delta)
+	assert.Equal(t, "host-1", records[1].AgentID)
+	assert.Equal(t, 1.5, *records[1].Value)
+	assert.True(t, records[1].CollectedAt.Equal(sinkBatch().CollectedAt))
+}
+
+func TestFileSink_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.ndjson")
+	s, err := newFileSink(path, 200, 2)
+	require.NoError(t, err)
+
+	// каждый пакет больше половины maxSize, поэтому каждая запись после первой ротирует файл
+	for i := 0; i < 4; i++ {
+		require.NoError(t, s.Write(sinkBatch()))
+	}
+	require.NoError(t, s.Close())
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		file, err := os.Open(name)
+		require.NoError(t, err)
+		assert.Len(t, readRecords(t, file), 2, name)
+		_ = file.Close()
+	}
+	assert.NoFileExists(t, path+".3")
+
+	// при повторном открытии файл дописывается
+	s, err = newFileSink(path, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, s.Write(sinkBatch()))
+	require.NoError(t, s.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	assert.Len(t, readRecords(t, file), 4)
+}
+
+// staticCollector источник с одной gauge метрикой
+type staticCollector struct{}
+
+func (staticCollector) Name() string            { return "static" }
+func (staticCollector) Interval() time.Duration { return 0 }
+func (staticCollector) Collect(context.Context) ([]dto.Metrics, error) {
+	value := 42.0
+	return []dto.Metrics{{ID: "Answer", MType: "gauge", Value: &value}}, nil
+}
+
+func TestAgent_RunOnce_FileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.ndjson")
+	destinationConfig, err := agentconfig.ParseSink("file:" + path)
+	require.NoError(t, err)
+	destinationConfig.HashKey = "secret"
+
+	agentLogger := logger.NewZapLogger()
+	config := &agentconfig.Config{
+		Agent: agentconfig.AgentConfig{PollInterval: time.Millisecond, AgentID: "once-test"},
+	}
+	a := &Agent{
+		config:     config,
+		metrics:    NewMetricsDicts(agentLogger, nil, nil),
+		collectors: collector.NewRegistry(),
+		logger:     agentLogger,
+	}
+	require.NoError(t, a.RegisterCollector(staticCollector{}))
+
+	uploader, err := NewUploader(config, destinationConfig, agentLogger)
+	require.NoError(t, err)
+	a.destinations = []*destination{{uploader: uploader}}
+
+	require.NoError(t, a.RunOnce(context.Background()))
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	records := readRecords(t, file)
+	require.Len(t, records, 1)
+	assert.Equal(t, "Answer", records[0].ID)
+	assert.Equal(t, "once-test", records[0].AgentID)
+	assert.NotEmpty(t, records[0].Hash)
+}
+
+func TestParseSink(t *testing.T) {
+	stdout, err := agentconfig.ParseSink("stdout:json")
+	require.NoError(t, err)
+	assert.Equal(t, agentconfig.DestinationConfig{Name: "stdout", Protocol: "stdout", Format: "json"}, stdout)
+
+	file, err := agentconfig.ParseSink("file:/var/log/metrics.ndjson")
+	require.NoError(t, err)
+	assert.Equal(t, "/var/log/metrics.ndjson", file.Path)
+
+	for _, spec := range []string{"stdout:xml", "file", "file:", "kafka:topic"} {
+		_, err = agentconfig.ParseSink(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+// readRecords читает JSON объекты вывода по одному на строку
+func readRecords(t *testing.T, r io.Reader) []sinkRecord {
+	t.Helper()
+
+	var records []sinkRecord
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var record sinkRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	require.NoError(t, scanner.Err())
+	return records
+}
@@ -0,0 +1,152 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"google.golang.org/grpc/status"
+
+	"github.com/atrian/devmetrics/internal/agent/collector"
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
+// Причины отбрасывания метрик в AgentDroppedMetrics_<сервер>_<причина>
+const (
+	dropOverflow    = "overflow"    // dropOverflow очередь отправки переполнена
+	dropRejected    = "rejected"    // dropRejected сервер окончательно отклонил пакет
+	dropUndelivered = "undelivered" // dropUndelivered пакет не отправлен, а очередь outbox не настроена или недоступна
+	dropEvicted     = "evicted"     // dropEvicted пакет вытеснен из переполненной очереди outbox
+)
+
+// telemetry метрики работы самого агента. Сохраняются в хранилище агента и отправляются вместе с остальными метриками:
+//
+//	AgentUploadAttempts_<сервер>            counter попытки отправки, включая повторы
+//	AgentUploadSuccess_<сервер>             counter отправленные пакеты
+//	AgentUploadFailures_<сервер>_<причина>  counter неотправленные пакеты по причине последней ошибки
+//	AgentUploadBatchSize_<сервер>           gauge   метрик в последнем отправленном пакете
+//	AgentUploadLatencyMs_<сервер>           gauge   время отправки последнего пакета с повторами
+//	AgentEncryptionMs_<сервер>              gauge   время шифрования последнего пакета
+//	AgentUploadQueueDepth_<сервер>          gauge   пакетов в очереди отправки
+//	AgentDroppedMetrics_<сервер>_<причина>  counter отброшенные метрики
+//	AgentFailoverSwitches_<сервер>          counter смены адреса сервера
+//	AgentCollectDurationMs_<источник>       gauge   время последнего опроса источника
+//	AgentCollectErrors_<источник>           counter ошибки опроса источника
+//
+// Имена серверов и источников приводятся к виду, допустимому в имени метрики.
+// Для gauge метрик можно настроить агрегаты за окно отправки, например AgentUploadLatencyMs_*=max,p95.
+// Методы nil *telemetry ничего не делают
+type telemetry struct {
+	metrics *MetricsDics
+}
+
+// newTelemetry метрики агента сохраняются в metrics
+func newTelemetry(metrics *MetricsDics) *telemetry {
+	return &telemetry{metrics: metrics}
+}
+
+// uploadAttempt попытка отправки пакета на сервер destination
+func (t *telemetry) uploadAttempt(destination string) {
+	t.counter("AgentUploadAttempts_"+collector.MetricSuffix(destination), 1)
+}
+
+// uploadSuccess пакет из size метрик отправлен на сервер destination за время latency
+func (t *telemetry) uploadSuccess(destination string, size int, latency time.Duration) {
+	suffix := collector.MetricSuffix(destination)
+	t.counter("AgentUploadSuccess_"+suffix, 1)
+	t.gauge("AgentUploadBatchSize_"+suffix, float64(size))
+	t.gauge("AgentUploadLatencyMs_"+suffix, milliseconds(latency))
+}
+
+// uploadFailure пакет не отправлен на сервер destination из-за ошибки err
+func (t *telemetry) uploadFailure(destination string, err error) {
+	t.counter("AgentUploadFailures_"+collector.MetricSuffix(destination)+"_"+failureReason(err), 1)
+}
+
+// encryption пакет для сервера destination зашифрован за время duration
+func (t *telemetry) encryption(destination string, duration time.Duration) {
+	t.gauge("AgentEncryptionMs_"+collector.MetricSuffix(destination), milliseconds(duration))
+}
+
+// queueDepth в очереди сервера destination depth пакетов
+func (t *telemetry) queueDepth(destination string, depth int) {
+	t.gauge("AgentUploadQueueDepth_"+collector.MetricSuffix(destination), float64(depth))
+}
+
+// dropped count метрик для сервера destination отброшено по причине reason
+func (t *telemetry) dropped(destination, reason string, count int) {
+	if count > 0 {
+		t.counter("AgentDroppedMetrics_"+collector.MetricSuffix(destination)+"_"+reason, int64(count))
+	}
+}
+
+// failoverSwitch сервер destination переключился на другой адрес
+func (t *telemetry) failoverSwitch(destination string) {
+	t.counter("AgentFailoverSwitches_"+collector.MetricSuffix(destination), 1)
+}
+
+// collect источник name опрошен за время duration с ошибкой err.
+// Имя источника, например exec:<команда>, приводится к виду, допустимому в имени метрики
+func (t *telemetry) collect(name string, duration time.Duration, err error) {
+	suffix := collector.MetricSuffix(name)
+	t.gauge("AgentCollectDurationMs_"+suffix, milliseconds(duration))
+	if err != nil {
+		t.counter("AgentCollectErrors_"+suffix, 1)
+	}
+}
+
+// counter увеличивает счетчик id на delta
+func (t *telemetry) counter(id string, delta int64) {
+	if t == nil {
+		return
+	}
+	t.metrics.Store([]dto.Metrics{{ID: id, MType: "counter", Delta: &delta}})
+}
+
+// gauge устанавливает метрику id в значение value
+func (t *telemetry) gauge(id string, value float64) {
+	if t == nil {
+		return
+	}
+	t.metrics.Store([]dto.Metrics{{ID: id, MType: "gauge", Value: &value}})
+}
+
+// milliseconds длительность в миллисекундах
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// failureReason причина ошибки отправки для имени метрики:
+// http<код>, grpc<код>, timeout, network, encode или other
+func failureReason(err error) string {
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		return "encode"
+	}
+
+	var httpStatus *statusError
+	if errors.As(err, &httpStatus) {
+		return fmt.Sprintf("http%d", httpStatus.code)
+	}
+
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &grpcErr) {
+		return "grpc" + grpcErr.GRPCStatus().Code().String()
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return "timeout"
+		}
+		return "network"
+	}
+
+	return "other"
+}
@@ -0,0 +1,138 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/atrian/devmetrics/internal/agent/outbox"
+	"github.com/atrian/devmetrics/internal/appconfig/agentconfig"
+	"github.com/atrian/devmetrics/internal/dto"
+	"github.com/atrian/devmetrics/internal/signature"
+	"github.com/atrian/devmetrics/pkg/logger"
+)
+
+func Test_failureReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: &statusError{code: http.StatusServiceUnavailable}, want: "http503"},
+		{err: fmt.Errorf("send: %w", status.Error(codes.Unavailable, "down")), want: "grpcUnavailable"},
+		{err: &permanentError{err: errors.New("marshal")}, want: "encode"},
+		{err: fmt.Errorf("do: %w", context.DeadlineExceeded), want: "timeout"},
+		{err: errors.New("unknown"), want: "other"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, failureReason(&UploadError{Err: tt.err, Attempts: 1}))
+	}
+}
+
+func TestUploader_SendBatch_Telemetry(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		statuses = []int{http.StatusServiceUnavailable, http.StatusOK, http.StatusBadRequest}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.WriteHeader(statuses[0])
+		statuses = statuses[1:]
+	}))
+	defer server.Close()
+
+	agentLogger := logger.NewZapLogger()
+	metrics := NewMetricsDicts(agentLogger, nil, nil)
+	uploader := &Uploader{
+		HTTPClient: server.Client(),
+		config: &agentconfig.Config{Transport: agentconfig.TransportConfig{
+			URLTemplate: "%v://%v/",
+			ContentType: "application/json",
+		}},
+		destination: agentconfig.DestinationConfig{
+			Name:     "production",
+			Protocol: "http",
+			Address:  strings.TrimPrefix(server.URL, "http://"),
+			Retry:    agentconfig.RetryConfig{MaxAttempts: 2, InitialBackoff: time.Millisecond},
+		},
+		hasher:    signature.NewSha256Hasher(),
+		telemetry: newTelemetry(metrics),
+		logger:    agentLogger,
+	}
+
+	value := 1.0
+	batch := outbox.Batch{CollectedAt: time.Now(), Metrics: []dto.Metrics{
+		{ID: "Alloc", MType: "gauge", Value: &value},
+		{ID: "HeapAlloc", MType: "gauge", Value: &value},
+	}}
+
+	// 503, затем успешный повтор
+	require.NoError(t, uploader.SendBatch(batch))
+	// 400 - пакет отклонен окончательно
+	require.Error(t, uploader.SendBatch(batch))
+
+	assert.Equal(t, counter(3), metrics.CounterDict["AgentUploadAttempts_production"].value)
+	assert.Equal(t, counter(1), metrics.CounterDict["AgentUploadSuccess_production"].value)
+	assert.Equal(t, counter(1), metrics.CounterDict["AgentUploadFailures_production_http400"].value)
+	assert.Equal(t, counter(2), metrics.CounterDict["AgentDroppedMetrics_production_rejected"].value)
+	assert.Equal(t, gauge(2), metrics.GaugeDict["AgentUploadBatchSize_production"].value)
+	assert.Contains(t, metrics.GaugeDict, "AgentUploadLatencyMs_production")
+}
+
+// failingCollector источник метрик, опрос которого всегда завершается ошибкой
+type failingCollector struct{}
+
+func (failingCollector) Name() string            { return "broken" }
+func (failingCollector) Interval() time.Duration { return 0 }
+func (failingCollector) Collect(context.Context) ([]dto.Metrics, error) {
+	return nil, errors.New("source is unavailable")
+}
+
+func TestAgent_RefreshStats_Telemetry(t *testing.T) {
+	agentLogger := logger.NewZapLogger()
+	metrics := NewMetricsDicts(agentLogger, nil, nil)
+	a := &Agent{metrics: metrics, telemetry: newTelemetry(metrics), logger: agentLogger}
+
+	a.RefreshStats(context.Background(), failingCollector{})
+	a.RefreshStats(context.Background(), failingCollector{})
+
+	assert.Equal(t, counter(2), metrics.CounterDict["AgentCollectErrors_broken"].value)
+	assert.Contains(t, metrics.GaugeDict, "AgentCollectDurationMs_broken")
+}
+
+func Test_telemetry_collect_Name(t *testing.T) {
+	agentLogger := logger.NewZapLogger()
+	metrics := NewMetricsDicts(agentLogger, nil, nil)
+
+	// имя источника внешней команды содержит недопустимые в имени метрики символы
+	newTelemetry(metrics).collect("exec:queue-depth", time.Millisecond, errors.New("exit status 1"))
+
+	assert.Contains(t, metrics.GaugeDict, "AgentCollectDurationMs_exec_queue_depth")
+	assert.Equal(t, counter(1), metrics.CounterDict["AgentCollectErrors_exec_queue_depth"].value)
+}
+
+func Test_telemetry_uploadFailure_Name(t *testing.T) {
+	agentLogger := logger.NewZapLogger()
+	metrics := NewMetricsDicts(agentLogger, nil, nil)
+
+	// имя сервера из JSON конфигурации может содержать "-"
+	newTelemetry(metrics).uploadFailure("dc-1", &UploadError{Err: errors.New("connection refused"), Attempts: 1})
+	newTelemetry(metrics).dropped("dc-1", dropRejected, 2)
+
+	assert.Len(t, metrics.CounterDict, 2)
+	assert.Contains(t, metrics.CounterDict, "AgentDroppedMetrics_dc_1_rejected")
+	for id := range metrics.CounterDict {
+		assert.NotContains(t, id, "-")
+	}
+}
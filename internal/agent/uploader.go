@@ -5,12 +5,21 @@ import (
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
+	"github.com/atrian/devmetrics/internal/agent/outbox"
 	"github.com/atrian/devmetrics/internal/appconfig/agentconfig"
 	"github.com/atrian/devmetrics/internal/crypter"
 	"github.com/atrian/devmetrics/internal/dto"
@@ -19,50 +28,156 @@ import (
 	pb "github.com/atrian/devmetrics/proto"
 )
 
-// Uploader отправляет данные метрик и счетчиков на удаленный сервер
+// Uploader отправляет данные метрик и счетчиков на один сервер destination
 type Uploader struct {
-	HTTPClient     *http.Client        // HTTPClient клиент для HTTP транспорта
-	GRPCClient     pb.DevMetricsClient // GRPCClient клиент для GRPC транспорта
-	GRPCConnection *grpc.ClientConn    // GRPCConnection GRPC соединение
-	config         *agentconfig.Config // config конфигурация приложения
-	hasher         signature.Hasher    // hasher подпись метрик
-	crypter        crypter.Crypter     // crypter отправка шифрованных данных
+	HTTPClient     *http.Client                  // HTTPClient клиент для HTTP транспорта
+	GRPCClients    []pb.DevMetricsClient         // GRPCClients клиенты для GRPC транспорта по адресам сервера
+	GRPCConnection []*grpc.ClientConn            // GRPCConnection GRPC соединения по адресам сервера
+	config         *agentconfig.Config           // config конфигурация приложения
+	destination    agentconfig.DestinationConfig // destination сервер, его адрес, ключи и политика повторов
+	hasher         signature.Hasher              // hasher подпись метрик
+	crypter        crypter.Crypter               // crypter отправка шифрованных данных
+	failover       *failover                     // failover выбор адреса из списка destination.Address, nil - используется destination.Address
+	outbox         *outbox.Outbox                // outbox очередь неотправленных пакетов, nil - пакеты при ошибке теряются
+	telemetry      *telemetry                    // telemetry метрики работы агента, nil - не собираются
+	sink           sink                          // sink локальный вывод для протоколов stdout и file, nil - отправка на сервер
+	counters       *counterDeltas                // counters отправленные значения счетчиков, nil - счетчики отправляются накопленными значениями
 	logger         logger.Logger
+	mu             sync.Mutex // mu при настроенной очереди outbox пакеты отправляются по одному, чтобы сохранить их порядок
 }
 
-// NewUploader принимает конфигурацию и логгер, подключает зависимости:
-// crypto.Sha256Hasher, http.Client
-func NewUploader(config *agentconfig.Config, logger logger.Logger) *Uploader {
+// NewUploader принимает конфигурацию, сервер отправки и логгер, подключает зависимости:
+// crypto.Sha256Hasher, http.Client. Очередь outbox сервера хранится в подкаталоге OutboxDir с его именем.
+// Для протоколов stdout и file пакеты выводятся локально вместо отправки на сервер.
+// Возвращает ошибку, если не удалось загрузить публичный ключ, открыть файл вывода или подготовить GRPC соединение
+func NewUploader(config *agentconfig.Config, destination agentconfig.DestinationConfig, logger logger.Logger) (*Uploader, error) {
 	keyManager := crypter.New()
-	if config.Agent.CryptoKey != "" {
-		pubKey, err := keyManager.ReadPublicKey(config.Agent.CryptoKey)
+	if destination.CryptoKey != "" {
+		pubKey, err := keyManager.ReadPublicKey(destination.CryptoKey)
 		if err != nil {
-			logger.Fatal("Can't load public key", err)
+			return nil, fmt.Errorf("destination %v: can't load public key: %w", destination.Name, err)
 		}
 		keyManager.RememberPublicKey(pubKey)
 	}
 
 	uploader := Uploader{
-		HTTPClient: &http.Client{},
-		config:     config,
-		hasher:     signature.NewSha256Hasher(),
-		crypter:    keyManager,
-		logger:     logger,
+		HTTPClient:  &http.Client{},
+		config:      config,
+		destination: destination,
+		hasher:      signature.NewSha256Hasher(),
+		crypter:     keyManager,
+		counters:    newCounterDeltas(),
+		logger:      logger,
 	}
 
-	// Инициализируем GRPC клиент, если выбран соответствующий протокол
-	if config.Transport.Protocol == "grpc" {
-		// устанавливаем соединение с сервером
-		conn, err := grpc.Dial(config.Transport.AddressGRPC, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	// Подключаем очередь неотправленных пакетов
+	if config.Agent.OutboxDir != "" {
+		box, err := outbox.New(filepath.Join(config.Agent.OutboxDir, destination.Name), config.Agent.OutboxMaxSize)
 		if err != nil {
-			logger.Fatal("Can't connect GRPC server", err)
+			logger.Error("Can't open outbox, undeliverable batches will be lost", err)
+		} else {
+			uploader.outbox = box
 		}
+	}
 
-		uploader.GRPCConnection = conn
-		uploader.GRPCClient = pb.NewDevMetricsClient(conn)
+	// локальный вывод вместо сервера
+	localSink, err := newSink(destination, config.Agent.AgentID)
+	if err != nil {
+		return nil, fmt.Errorf("destination %v: %w", destination.Name, err)
+	}
+	uploader.sink = localSink
+
+	// адрес сервера может быть списком через запятую в порядке приоритета
+	addresses := splitAddresses(destination.Address)
+	uploader.failover = newFailover(destination.Name, addresses, uploader.probe, logger)
+
+	// Инициализируем GRPC клиенты, если выбран соответствующий протокол
+	if destination.Protocol == "grpc" {
+		for _, address := range addresses {
+			// соединение устанавливается при первом запросе
+			conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				_ = uploader.Close()
+				return nil, fmt.Errorf("destination %v: can't connect GRPC server: %w", destination.Name, err)
+			}
+
+			uploader.GRPCConnection = append(uploader.GRPCConnection, conn)
+			uploader.GRPCClients = append(uploader.GRPCClients, pb.NewDevMetricsClient(conn))
+		}
 	}
 
-	return &uploader
+	return &uploader, nil
+}
+
+// Name имя сервера отправки
+func (uploader *Uploader) Name() string {
+	return uploader.destination.Name
+}
+
+// Close закрывает GRPC соединения и локальный вывод
+func (uploader *Uploader) Close() error {
+	var errs []error
+	if uploader.sink != nil {
+		if err := uploader.sink.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, conn := range uploader.GRPCConnection {
+		if err := conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("close connections: %v", errs)
+	}
+	return nil
+}
+
+// current индекс и адрес сервера, на который выполняется отправка
+func (uploader *Uploader) current() (int, string) {
+	if uploader.failover == nil {
+		return 0, uploader.destination.Address
+	}
+	return uploader.failover.Current()
+}
+
+// probe проверка доступности адреса сервера с индексом index:
+// для http запрос GET /healthz, который не зависит от хранилища сервера, для grpc - стандартный сервис grpc.health.v1.
+// Сервер, ответивший кодом 5xx или статусом, отличным от SERVING, считается недоступным.
+// HTTP сервер без /healthz отвечает 404 и считается доступным.
+// GRPC сервер без сервиса проверки доступности считается доступным
+func (uploader *Uploader) probe(ctx context.Context, index int) error {
+	if uploader.destination.Protocol == "grpc" {
+		resp, err := healthpb.NewHealthClient(uploader.GRPCConnection[index]).Check(ctx, &healthpb.HealthCheckRequest{})
+		if status.Code(err) == codes.Unimplemented {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("health status %v", resp.GetStatus())
+		}
+		return nil
+	}
+
+	endpoint := fmt.Sprintf(uploader.config.Transport.URLTemplate,
+		uploader.destination.Protocol, uploader.failover.addresses[index]) + "healthz"
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := uploader.HTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return &statusError{code: resp.StatusCode}
+	}
+	return nil
 }
 
 // SendStat отправка одной подписанной метрики на сервер в JSON формате
@@ -75,7 +190,7 @@ func (uploader *Uploader) SendStat(metrics *MetricsDics) {
 			MType: "gauge",
 			Delta: nil,
 			Value: &gaugeValue,
-			Hash:  uploader.hasher.Hash(fmt.Sprintf("%s:gauge:%f", key, gaugeValue), uploader.config.Agent.HashKey),
+			Hash:  uploader.hasher.Hash(fmt.Sprintf("%s:gauge:%f", key, gaugeValue), uploader.destination.HashKey),
 		})
 
 		if err != nil {
@@ -93,7 +208,7 @@ func (uploader *Uploader) SendStat(metrics *MetricsDics) {
 			MType: "counter",
 			Delta: &counterValue,
 			Value: nil,
-			Hash:  uploader.hasher.Hash(fmt.Sprintf("%s:counter:%d", key, counterValue), uploader.config.Agent.HashKey),
+			Hash:  uploader.hasher.Hash(fmt.Sprintf("%s:counter:%d", key, counterValue), uploader.destination.HashKey),
 		})
 
 		if err != nil {
@@ -105,36 +220,31 @@ func (uploader *Uploader) SendStat(metrics *MetricsDics) {
 	}
 }
 
-// MarshallMetrics маршалит текущие значения метрик данные в JSON
-func (uploader *Uploader) marshallMetrics(metrics *MetricsDics) ([]byte, error) {
-	exportedMetrics := uploader.signMetrics(metrics)
-	jsonMetrics, err := json.Marshal(exportedMetrics)
-	return jsonMetrics, err
-}
-
-// signMetrics подписывает метрики хешом перед отправкой
-func (uploader *Uploader) signMetrics(metrics *MetricsDics) *[]dto.Metrics {
-	// создаем функцию-декоратор для того чтобы не тащить хешер и конфиг в другой слой приложения напрямую
-	configuredHasher := func(metricType, id string, delta *int64, value *float64) string {
-		switch metricType {
+// signMetrics возвращает копию метрик, подписанных ключом сервера отправки.
+// Пакет не изменяется, так как он общий для всех серверов
+func (uploader *Uploader) signMetrics(metrics []dto.Metrics) []dto.Metrics {
+	signed := make([]dto.Metrics, len(metrics))
+	for i, metric := range metrics {
+		switch metric.MType {
 		case "counter":
-			return uploader.hasher.Hash(fmt.Sprintf("%s:counter:%d", id, *delta),
-				uploader.config.Agent.HashKey)
+			metric.Hash = uploader.hasher.Hash(fmt.Sprintf("%s:counter:%d", metric.ID, *metric.Delta),
+				uploader.destination.HashKey)
 		case "gauge":
-			return uploader.hasher.Hash(fmt.Sprintf("%s:gauge:%f", id, *value),
-				uploader.config.Agent.HashKey)
-		default:
-			return ""
+			metric.Hash = uploader.hasher.Hash(fmt.Sprintf("%s:gauge:%f", metric.ID, *metric.Value),
+				uploader.destination.HashKey)
 		}
+		signed[i] = metric
 	}
 
-	return metrics.exportMetrics(configuredHasher)
+	return signed
 }
 
 // encryptData шифрует метрику для передачи по HTTP
 func (uploader *Uploader) encryptData(data []byte) ([]byte, error) {
-	if uploader.config.Agent.CryptoKey != "" {
+	if uploader.destination.CryptoKey != "" {
+		started := time.Now()
 		secureData, err := uploader.crypter.Encrypt(data)
+		uploader.telemetry.encryption(uploader.Name(), time.Since(started))
 		if err != nil {
 			uploader.logger.Error("Can't encrypt message", err)
 		}
@@ -143,23 +253,138 @@ func (uploader *Uploader) encryptData(data []byte) ([]byte, error) {
 	return data, nil
 }
 
-// SendAllStats отправка всех метрик на сервер
-func (uploader *Uploader) SendAllStats(metrics *MetricsDics) {
-	if uploader.config.Transport.Protocol == "grpc" {
-		uploader.sendStatsViaGrpc(metrics)
-	} else {
-		uploader.sendStatsViaHttp(metrics)
+// SendAllStats выгружает текущие метрики и отправляет их на сервер, см. SendBatch
+func (uploader *Uploader) SendAllStats(metrics *MetricsDics) error {
+	return uploader.SendBatch(outbox.Batch{CollectedAt: time.Now(), Metrics: *metrics.exportMetrics(nil)})
+}
+
+// SendBatch подписывает пакет и отправляет его на сервер с повторами по политике сервера Retry.
+// Пакет содержит накопленные значения счетчиков, на сервер отправляется их прирост с предыдущего пакета.
+// Если настроена очередь outbox, сначала отправляются сохраненные в ней пакеты,
+// а пакет, который не удалось отправить из-за временной ошибки, сохраняется в очередь вместе с приростом счетчиков.
+// С очередью отправки на сервер выполняются по одной независимо от RateLimit,
+// иначе новый пакет может обогнать пакеты из очереди.
+// Прирост счетчиков пакета, который отклонен или не сохранен в очередь, войдет в следующий пакет.
+// Возвращает *UploadError, если пакет не отправлен
+func (uploader *Uploader) SendBatch(batch outbox.Batch) error {
+	if uploader.outbox != nil {
+		uploader.mu.Lock()
+		defer uploader.mu.Unlock()
 	}
+
+	batch.Metrics = uploader.counters.take(batch.Metrics)
+
+	// пока очередь не отправлена, новые пакеты встают в ее конец, чтобы сервер получал их в порядке сбора
+	if err := uploader.replayOutbox(); err != nil {
+		uploader.spool(batch)
+		return err
+	}
+
+	err := uploader.sendBatch(context.Background(), batch)
+	var uploadErr *UploadError
+	if errors.As(err, &uploadErr) && !uploadErr.Permanent {
+		uploader.spool(batch)
+	} else if err != nil {
+		uploader.counters.rollback(batch.Metrics)
+		uploader.telemetry.dropped(uploader.Name(), dropRejected, len(batch.Metrics))
+	}
+	return err
+}
+
+// replayOutbox отправляет пакеты из очереди в порядке сбора.
+// Пакеты, отклоненные сервером окончательно, удаляются из очереди, прирост их счетчиков войдет в следующий пакет.
+// Возвращает ошибку, если очередь не удалось отправить целиком. Вызывается под uploader.mu
+func (uploader *Uploader) replayOutbox() error {
+	if uploader.outbox == nil {
+		return nil
+	}
+
+	for {
+		entry, ok, err := uploader.outbox.Peek()
+		if err != nil {
+			uploader.logger.Error("Outbox batch dropped", err)
+			continue
+		}
+		if !ok {
+			return nil
+		}
+
+		err = uploader.sendBatch(context.Background(), entry.Batch)
+		var uploadErr *UploadError
+		if errors.As(err, &uploadErr) && !uploadErr.Permanent {
+			return fmt.Errorf("outbox replay, %v batches pending: %w", uploader.outbox.Len(), err)
+		}
+
+		uploader.outbox.Remove(entry.ID)
+		if err != nil {
+			uploader.counters.rollback(entry.Batch.Metrics)
+			uploader.telemetry.dropped(uploader.Name(), dropRejected, len(entry.Batch.Metrics))
+			uploader.logger.Error(fmt.Sprintf("Outbox batch collected at %v rejected", entry.Batch.CollectedAt), err)
+			continue
+		}
+		uploader.logger.Info(fmt.Sprintf("Outbox batch collected at %v sent", entry.Batch.CollectedAt))
+	}
+}
+
+// spool сохраняет пакет в очередь, если она настроена.
+// Иначе gauge метрики пакета теряются, а прирост счетчиков войдет в следующий пакет.
+// Так же учитываются пакеты, вытесненные из переполненной очереди
+func (uploader *Uploader) spool(batch outbox.Batch) {
+	if len(batch.Metrics) == 0 {
+		return
+	}
+	if uploader.outbox == nil {
+		uploader.counters.rollback(batch.Metrics)
+		uploader.telemetry.dropped(uploader.Name(), dropUndelivered, len(batch.Metrics))
+		return
+	}
+
+	evicted, err := uploader.outbox.Push(batch)
+	if err != nil {
+		uploader.counters.rollback(batch.Metrics)
+		uploader.telemetry.dropped(uploader.Name(), dropUndelivered, len(batch.Metrics))
+		uploader.logger.Error("Can't save batch to outbox", err)
+		return
+	}
+	// вытесненные пакеты не будут отправлены, прирост их счетчиков входит в следующий пакет
+	for _, old := range evicted {
+		uploader.counters.rollback(old.Metrics)
+		uploader.telemetry.dropped(uploader.Name(), dropEvicted, len(old.Metrics))
+		uploader.logger.Warning(fmt.Sprintf("Outbox is full, batch collected at %v evicted", old.CollectedAt))
+	}
+	uploader.logger.Info(fmt.Sprintf("Batch saved to outbox, %v batches pending", uploader.outbox.Len()))
+}
+
+// sendBatch отправка пакета выбранным протоколом с повторами после временных ошибок.
+// Попытки, результат и время отправки учитываются в метриках агента
+func (uploader *Uploader) sendBatch(ctx context.Context, batch outbox.Batch) error {
+	started := time.Now()
+	err := withRetry(ctx, uploader.destination.Retry, func(ctx context.Context) error {
+		uploader.telemetry.uploadAttempt(uploader.Name())
+		if uploader.sink != nil {
+			return uploader.sink.Write(outbox.Batch{CollectedAt: batch.CollectedAt, Metrics: uploader.signMetrics(batch.Metrics)})
+		}
+		if uploader.destination.Protocol == "grpc" {
+			return uploader.sendStatsViaGrpc(ctx, batch)
+		}
+		return uploader.sendStatsViaHttp(ctx, batch)
+	})
+
+	if err != nil {
+		uploader.telemetry.uploadFailure(uploader.Name(), err)
+		return err
+	}
+	uploader.telemetry.uploadSuccess(uploader.Name(), len(batch.Metrics), time.Since(started))
+	return nil
 }
 
 // sendStatsViaGrpc Отправка статистики по протоколу Grpc.
-func (uploader *Uploader) sendStatsViaGrpc(metrics *MetricsDics) {
+// Время сбора передается в метаданных запроса
+func (uploader *Uploader) sendStatsViaGrpc(ctx context.Context, batch outbox.Batch) error {
 	var upsertMetricsRequest pb.UpsertMetricsRequest
 
 	// TODO добавить подпись метрик в PROTO?
-	exportedMetrics := uploader.signMetrics(metrics)
-
-	for _, metric := range *exportedMetrics {
+	for _, metric := range uploader.signMetrics(batch.Metrics) {
 		switch metric.MType {
 		case "gauge":
 			upsertMetricsRequest.Metrics = append(upsertMetricsRequest.Metrics, &pb.Metric{
@@ -183,27 +408,50 @@ func (uploader *Uploader) sendStatsViaGrpc(metrics *MetricsDics) {
 		}
 	}
 
-	_, err := uploader.GRPCClient.UpdateMetrics(context.Background(), &upsertMetricsRequest)
+	source := uploader.source()
+	source.CollectedAt = batch.CollectedAt
+	ctx = metadata.AppendToOutgoingContext(ctx,
+		dto.CollectedAtHeader, source.EncodeCollectedAt(),
+		dto.AgentIDHeader, source.AgentID,
+		dto.AgentLabelsHeader, source.EncodeLabels(),
+		dto.AgentSignatureHeader, uploader.signSource(source))
+
+	index, _ := uploader.current()
+	_, err := uploader.GRPCClients[index].UpdateMetrics(ctx, &upsertMetricsRequest)
 	if err != nil {
-		uploader.logger.Error("GRPCClient.UpdateMetrics failed", err)
+		return fmt.Errorf("GRPCClient.UpdateMetrics failed: %w", err)
 	}
+	return nil
+}
+
+// source идентификация агента, передаваемая с каждым пакетом
+func (uploader *Uploader) source() dto.Source {
+	return dto.Source{AgentID: uploader.config.Agent.AgentID, Labels: uploader.config.Agent.Labels}
+}
+
+// signSource подпись идентификации агента ключом HashKey сервера, без ключа - пустая строка
+func (uploader *Uploader) signSource(source dto.Source) string {
+	if uploader.destination.HashKey == "" {
+		return ""
+	}
+	return uploader.hasher.Hash(source.SignedData(), uploader.destination.HashKey)
 }
 
 // sendStatsViaHttp Отправка статистики по протоколу Transport. С шифрованием и сжатием Gzip
-func (uploader *Uploader) sendStatsViaHttp(metrics *MetricsDics) {
+func (uploader *Uploader) sendStatsViaHttp(ctx context.Context, batch outbox.Batch) error {
 	// маршалим данные в JSON
-	data, err := uploader.marshallMetrics(metrics)
+	data, err := json.Marshal(uploader.signMetrics(batch.Metrics))
 	if err != nil {
-		uploader.logger.Error("SendAllStats marshallMetrics error", err)
+		return &permanentError{err: fmt.Errorf("marshal metrics: %w", err)}
 	}
 
 	// шифруем данные при необходимости
 	data, err = uploader.encryptData(data)
 	if err != nil {
-		uploader.logger.Error("SendAllStats encryptData error", err)
+		return &permanentError{err: fmt.Errorf("encrypt metrics: %w", err)}
 	}
 
-	uploader.sendGzippedRequest(data)
+	return uploader.sendGzippedRequest(ctx, data, batch.CollectedAt)
 }
 
 // sendRequest отправка запроса, используется для отправки одной метрики методом POST
@@ -233,11 +481,13 @@ func (uploader *Uploader) sendRequest(body []byte) {
 }
 
 // sendGzippedRequest отправка запроса, используется для отправки метрик методом POST
-// Используется gzip сжатие, передается заголовок Content-Encoding: gzip
-func (uploader *Uploader) sendGzippedRequest(body []byte) {
+// Используется gzip сжатие, передается заголовок Content-Encoding: gzip, время сбора dto.CollectedAtHeader
+// и идентификация агента dto.AgentIDHeader, dto.AgentLabelsHeader, dto.AgentSignatureHeader.
+// Ответ сервера с кодом, отличным от 2xx, возвращается как *statusError
+func (uploader *Uploader) sendGzippedRequest(ctx context.Context, body []byte, collectedAt time.Time) error {
 	if len(body) == 0 {
 		uploader.logger.Debug("Empty body, return")
-		return
+		return nil
 	}
 
 	var gzBody bytes.Buffer
@@ -245,49 +495,59 @@ func (uploader *Uploader) sendGzippedRequest(body []byte) {
 
 	gzipWriter := gzip.NewWriter(&gzBody)
 	if _, err := gzipWriter.Write(body); err != nil {
-		uploader.logger.Error("sendGzippedRequest gzipWriter.Write", err)
-		return
+		return &permanentError{err: fmt.Errorf("sendGzippedRequest gzipWriter.Write: %w", err)}
 	}
 	err := gzipWriter.Close()
 	if err != nil {
-		uploader.logger.Error("sendGzippedRequest gzipWriter.Close", err)
-		return
+		return &permanentError{err: fmt.Errorf("sendGzippedRequest gzipWriter.Close: %w", err)}
 	}
 
 	// собираем request
-	request, err := http.NewRequest(http.MethodPost, endpoint, &gzBody)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, &gzBody)
 	if err != nil {
-		uploader.logger.Error("sendGzippedRequest http.NewRequest", err)
+		return &permanentError{err: fmt.Errorf("sendGzippedRequest http.NewRequest: %w", err)}
 	}
 
 	// устанавливаем заголовки
 	request.Header.Set("X-Real-IP", uploader.config.Agent.AgentIP.String())
 	request.Header.Set("Content-Type", uploader.config.Transport.ContentType)
 	request.Header.Set("Content-Encoding", "gzip")
+	source := uploader.source()
+	source.CollectedAt = collectedAt
+	request.Header.Set(dto.CollectedAtHeader, source.EncodeCollectedAt())
+	request.Header.Set(dto.AgentIDHeader, source.AgentID)
+	request.Header.Set(dto.AgentLabelsHeader, source.EncodeLabels())
+	request.Header.Set(dto.AgentSignatureHeader, uploader.signSource(source))
 
 	resp, err := uploader.HTTPClient.Do(request)
 	if err != nil {
-		uploader.logger.Error("sendGzippedRequest HTTPClient.Do", err)
-		return
+		return fmt.Errorf("sendGzippedRequest HTTPClient.Do: %w", err)
 	}
 
 	bcErr := resp.Body.Close()
 	if bcErr != nil {
-		uploader.logger.Error("sendGzippedRequest Body.Close error", err)
+		uploader.logger.Error("sendGzippedRequest Body.Close error", bcErr)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &statusError{code: resp.StatusCode}
 	}
+	return nil
 }
 
 // buildStatUploadURL построение целевого адреса для отправки одной метрики
 // Deprecated: отправка одной метрики больше не используется, применяйте buildStatsUploadURL
 func (uploader *Uploader) buildStatUploadURL() string {
+	_, address := uploader.current()
 	return fmt.Sprintf(uploader.config.Transport.URLTemplate,
-		uploader.config.Transport.Protocol,
-		uploader.config.Transport.AddressHTTP) + "update/"
+		uploader.destination.Protocol,
+		address) + "update/"
 }
 
 // buildStatsUploadURL построение целевого адреса для массовой отправки метрик
 func (uploader *Uploader) buildStatsUploadURL() string {
+	_, address := uploader.current()
 	return fmt.Sprintf(uploader.config.Transport.URLTemplate,
-		uploader.config.Transport.Protocol,
-		uploader.config.Transport.AddressHTTP) + "updates/"
+		uploader.destination.Protocol,
+		address) + "updates/"
 }
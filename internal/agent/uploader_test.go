@@ -1,11 +1,23 @@
 package agent
 
 import (
+	"compress/gzip"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/atrian/devmetrics/internal/agent/outbox"
 	"github.com/atrian/devmetrics/internal/appconfig/agentconfig"
+	"github.com/atrian/devmetrics/internal/dto"
+	"github.com/atrian/devmetrics/internal/signature"
 	"github.com/atrian/devmetrics/pkg/logger"
 )
 
@@ -49,8 +61,9 @@ func TestUploader_buildStatUploadURL(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			uploader := &Uploader{
-				HTTPClient: tt.fields.client,
-				config:     tt.fields.config,
+				HTTPClient:  tt.fields.client,
+				config:      tt.fields.config,
+				destination: tt.fields.config.UploadDestinations()[0],
 			}
 			if got := uploader.buildStatsUploadURL(); got != tt.want {
 				t.Errorf("buildStatsUploadURL() = %v, want %v", got, tt.want)
@@ -58,3 +71,210 @@ func TestUploader_buildStatUploadURL(t *testing.T) {
 		})
 	}
 }
+
+func TestUploader_SendAllStats_Outbox(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		available bool
+		received  []float64
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		received = append(received, requestGauge(r, "Alloc"))
+	}))
+	defer server.Close()
+
+	box, err := outbox.New(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	agentLogger := logger.NewZapLogger()
+	uploader := &Uploader{
+		HTTPClient: server.Client(),
+		config: &agentconfig.Config{Transport: agentconfig.TransportConfig{
+			URLTemplate: "%v://%v/",
+			ContentType: "application/json",
+		}},
+		destination: agentconfig.DestinationConfig{
+			Name:     "test",
+			Protocol: "http",
+			Address:  strings.TrimPrefix(server.URL, "http://"),
+		},
+		hasher: signature.NewSha256Hasher(),
+		outbox: box,
+		logger: agentLogger,
+	}
+
+	metrics := NewMetricsDicts(agentLogger, nil, nil)
+	store := func(value float64) {
+		metrics.Store([]dto.Metrics{{ID: "Alloc", MType: "gauge", Value: &value}})
+	}
+
+	// сервер недоступен - пакеты сохраняются в очередь
+	store(1)
+	uploader.SendAllStats(metrics)
+	store(2)
+	uploader.SendAllStats(metrics)
+	assert.Equal(t, 2, box.Len())
+
+	// сервер доступен - сначала отправляется очередь в порядке сбора, затем текущий пакет
+	mu.Lock()
+	available = true
+	mu.Unlock()
+	store(3)
+	uploader.SendAllStats(metrics)
+	assert.Equal(t, 0, box.Len())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []float64{1, 2, 3}, received)
+}
+
+func TestUploader_SendBatch_OutboxConcurrent(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		inFlight    int
+		maxInFlight int
+		received    []float64
+		collectedAt []time.Time
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		received = append(received, requestGauge(r, "Alloc"))
+		collectedAt = append(collectedAt, dto.ParseCollectedAt(r.Header.Get(dto.CollectedAtHeader)))
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	box, err := outbox.New(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	agentLogger := logger.NewZapLogger()
+	uploader := &Uploader{
+		HTTPClient: server.Client(),
+		config: &agentconfig.Config{Transport: agentconfig.TransportConfig{
+			URLTemplate: "%v://%v/",
+			ContentType: "application/json",
+		}},
+		destination: agentconfig.DestinationConfig{
+			Name:     "test",
+			Protocol: "http",
+			Address:  strings.TrimPrefix(server.URL, "http://"),
+		},
+		hasher: signature.NewSha256Hasher(),
+		outbox: box,
+		logger: agentLogger,
+	}
+
+	batch := func(minute int) outbox.Batch {
+		value := float64(minute)
+		return outbox.Batch{
+			CollectedAt: time.Date(2022, 12, 1, 10, minute, 0, 0, time.UTC),
+			Metrics:     []dto.Metrics{{ID: "Alloc", MType: "gauge", Value: &value}},
+		}
+	}
+
+	// в очереди пакеты, не отправленные ранее
+	for minute := 0; minute < 3; minute++ {
+		_, err = box.Push(batch(minute))
+		require.NoError(t, err)
+	}
+
+	// несколько воркеров отправляют новые пакеты одновременно с отправкой очереди
+	var wg sync.WaitGroup
+	for minute := 3; minute < 7; minute++ {
+		wg.Add(1)
+		go func(minute int) {
+			defer wg.Done()
+			assert.NoError(t, uploader.SendBatch(batch(minute)))
+		}(minute)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, maxInFlight)
+	require.Len(t, received, 7)
+	// новые пакеты не обгоняют пакеты из очереди, пакеты из очереди сохраняют исходное время сбора
+	assert.Equal(t, []float64{0, 1, 2}, received[:3])
+	for i, at := range collectedAt {
+		if i < 3 {
+			assert.True(t, batch(i).CollectedAt.Equal(at), at)
+		}
+		assert.False(t, at.IsZero())
+	}
+}
+
+func TestUploader_SendBatch_Identity(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+	}))
+	defer server.Close()
+
+	uploader := &Uploader{
+		HTTPClient: server.Client(),
+		config: &agentconfig.Config{
+			Transport: agentconfig.TransportConfig{URLTemplate: "%v://%v/", ContentType: "application/json"},
+			Agent: agentconfig.AgentConfig{
+				AgentID: "web-1-4b1f",
+				Labels:  map[string]string{"env": "prod", "dc": "msk"},
+			},
+		},
+		destination: agentconfig.DestinationConfig{
+			Name:     "test",
+			Protocol: "http",
+			Address:  strings.TrimPrefix(server.URL, "http://"),
+			HashKey:  "secret",
+		},
+		hasher: signature.NewSha256Hasher(),
+		logger: logger.NewZapLogger(),
+	}
+
+	value := 1.0
+	err := uploader.SendBatch(outbox.Batch{
+		CollectedAt: time.Now(),
+		Metrics:     []dto.Metrics{{ID: "Alloc", MType: "gauge", Value: &value}},
+	})
+	require.NoError(t, err)
+
+	header := <-headers
+	assert.Equal(t, "web-1-4b1f", header.Get(dto.AgentIDHeader))
+	assert.Equal(t, map[string]string{"env": "prod", "dc": "msk"}, dto.ParseLabels(header.Get(dto.AgentLabelsHeader)))
+
+	// идентификация подписана ключом сервера
+	source := dto.Source{AgentID: header.Get(dto.AgentIDHeader), Labels: dto.ParseLabels(header.Get(dto.AgentLabelsHeader))}
+	assert.True(t, uploader.hasher.Compare(header.Get(dto.AgentSignatureHeader), source.SignedData(), "secret"))
+}
+
+// requestGauge значение gauge метрики id из сжатого gzip тела запроса, 0 - метрики нет
+func requestGauge(r *http.Request, id string) float64 {
+	gz, err := gzip.NewReader(r.Body)
+	if err != nil {
+		return 0
+	}
+	var metrics []dto.Metrics
+	if err = json.NewDecoder(gz).Decode(&metrics); err != nil {
+		return 0
+	}
+	for _, metric := range metrics {
+		if metric.ID == id && metric.Value != nil {
+			return *metric.Value
+		}
+	}
+	return 0
+}
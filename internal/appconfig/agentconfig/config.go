@@ -4,10 +4,13 @@ package agentconfig
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"net"
 	"os"
+	"path"
+	"regexp"
 	"strings"
 	"time"
 
@@ -20,6 +23,9 @@ var (
 	address, addressGrpc, hashKey, cryptoKey, jsonConf *string
 	reportInterval                                     *time.Duration
 	pollInterval                                       *time.Duration
+	rateLimit                                          *int
+	sink                                               *string
+	once                                               *bool
 )
 
 // Config конфигурация приложения отправки метрик
@@ -36,22 +42,392 @@ type ConfDummy struct {
 	ReportInterval string `json:"report_interval,omitempty"`
 	PollInterval   string `json:"poll_interval,omitempty"`
 	CryptoKey      string `json:"crypto_key,omitempty"`
+	// DiskMountpointsInclude список точек монтирования для сбора дисковых метрик
+	DiskMountpointsInclude []string `json:"disk_mountpoints_include,omitempty"`
+	// DiskMountpointsExclude список точек монтирования, исключенных из сбора дисковых метрик
+	DiskMountpointsExclude []string `json:"disk_mountpoints_exclude,omitempty"`
+	// NetInterfacesInclude список сетевых интерфейсов для сбора сетевых метрик
+	NetInterfacesInclude []string `json:"net_interfaces_include,omitempty"`
+	// NetInterfacesExclude список сетевых интерфейсов, исключенных из сбора сетевых метрик
+	NetInterfacesExclude []string `json:"net_interfaces_exclude,omitempty"`
+	// Processes список отслеживаемых процессов в формате ProcessConfig
+	Processes []ProcessConfig `json:"processes,omitempty"`
+	// MemStats отправлять метрики runtime.MemStats
+	MemStats *bool `json:"memstats,omitempty"`
+	// CgroupRoot точка монтирования cgroup
+	CgroupRoot string `json:"cgroup_root,omitempty"`
+	// Exec внешние команды для сбора метрик
+	Exec []ExecDummy `json:"exec,omitempty"`
+	// PrometheusTargets адреса эндпоинтов в формате Prometheus
+	PrometheusTargets []string `json:"prometheus_targets,omitempty"`
+	// StatsDAddress UDP адрес приема StatsD метрик
+	StatsDAddress string `json:"statsd_address,omitempty"`
+	// PushAddress адрес локального HTTP эндпоинта приема метрик
+	PushAddress string `json:"push_address,omitempty"`
+	// LogTail файлы логов и правила извлечения метрик
+	LogTail LogTailConfig `json:"log_tail,omitempty"`
+	// Aggregations агрегаты gauge метрик за окно отправки в формате AggregationConfig
+	Aggregations []AggregationConfig `json:"aggregations,omitempty"`
+	// Relabel правила фильтрации и переименования метрик перед отправкой
+	Relabel []RelabelConfig `json:"relabel,omitempty"`
+	// OutboxDir каталог для неотправленных пакетов метрик
+	OutboxDir string `json:"outbox_dir,omitempty"`
+	// OutboxMaxSize ограничение размера каталога OutboxDir в байтах
+	OutboxMaxSize int64 `json:"outbox_max_size,omitempty"`
+	// Retry политика повторной отправки
+	Retry *RetryDummy `json:"retry,omitempty"`
+	// RateLimit количество одновременных отправок на сервер, с очередью outbox отправки выполняются по одной
+	RateLimit int `json:"rate_limit,omitempty"`
+	// UploadQueueSize размер очереди пакетов, ожидающих отправки
+	UploadQueueSize int `json:"upload_queue_size,omitempty"`
+	// OverflowPolicy политика переполнения очереди отправки
+	OverflowPolicy string `json:"upload_overflow_policy,omitempty"`
+	// HealthCheckInterval интервал проверки доступности адресов сервера
+	HealthCheckInterval string `json:"health_check_interval,omitempty"`
+	// Destinations серверы для отправки метрик
+	Destinations []DestinationDummy `json:"destinations,omitempty"`
+	// AgentID идентификатор агента
+	AgentID string `json:"agent_id,omitempty"`
+	// AgentIDFile файл для хранения сгенерированного идентификатора агента
+	AgentIDFile string `json:"agent_id_file,omitempty"`
+	// Labels статические метки агента
+	Labels map[string]string `json:"labels,omitempty"`
+	// Sink локальный вывод метрик вместо отправки на сервер
+	Sink string `json:"sink,omitempty"`
+}
+
+// DestinationDummy шаблон для парсинга сервера отправки метрик из JSON конфигурации.
+// Не заданная политика повторов берется из общей политики retry
+type DestinationDummy struct {
+	Name      string      `json:"name"`
+	Protocol  string      `json:"protocol,omitempty"`
+	Address   string      `json:"address"`
+	HashKey   string      `json:"hash_key,omitempty"`
+	CryptoKey string      `json:"crypto_key,omitempty"`
+	Retry     *RetryDummy `json:"retry,omitempty"`
+	// Format, Path, MaxSize, MaxBackups параметры локального вывода stdout и file
+	Format     string `json:"format,omitempty"`
+	Path       string `json:"path,omitempty"`
+	MaxSize    int64  `json:"max_size,omitempty"`
+	MaxBackups int    `json:"max_backups,omitempty"`
+}
+
+// RetryDummy шаблон для парсинга политики повторной отправки из JSON конфигурации
+type RetryDummy struct {
+	MaxAttempts    int     `json:"max_attempts,omitempty"`
+	InitialBackoff string  `json:"initial_backoff,omitempty"`
+	MaxBackoff     string  `json:"max_backoff,omitempty"`
+	Jitter         float64 `json:"jitter,omitempty"`
+	Deadline       string  `json:"deadline,omitempty"`
+}
+
+// ExecDummy шаблон для парсинга описания внешней команды из JSON конфигурации
+type ExecDummy struct {
+	Name     string   `json:"name"`
+	Command  string   `json:"command"`
+	Args     []string `json:"args,omitempty"`
+	Interval string   `json:"interval,omitempty"`
+	Timeout  string   `json:"timeout,omitempty"`
 }
 
 // AgentConfig конфигурация параметров сбора и отправки метрик
 type AgentConfig struct {
-	AgentIP        net.IP        // AgentIP адрес агента. Определяется при старте
-	CryptoKey      string        `env:"CRYPTO_KEY"`      // CryptoKey путь до файла с публичным ключом
-	HashKey        string        `env:"KEY"`             // HashKey ключ подписи метрик. Если пустой - метрики не подписываются
-	PollInterval   time.Duration `env:"POLL_INTERVAL"`   // PollInterval интервал сбора метрик, по умолчанию 2 секунды
-	ReportInterval time.Duration `env:"REPORT_INTERVAL"` // ReportInterval интервал отправки метрик на сервер, по умолчанию 10 секунд
+	AgentIP             net.IP              // AgentIP адрес агента. Определяется при старте
+	CryptoKey           string              `env:"CRYPTO_KEY"`                          // CryptoKey путь до файла с публичным ключом
+	HashKey             string              `env:"KEY"`                                 // HashKey ключ подписи метрик. Если пустой - метрики не подписываются
+	PollInterval        time.Duration       `env:"POLL_INTERVAL"`                       // PollInterval интервал сбора метрик, по умолчанию 2 секунды
+	ReportInterval      time.Duration       `env:"REPORT_INTERVAL"`                     // ReportInterval интервал отправки метрик на сервер, по умолчанию 10 секунд
+	MemStats            bool                `env:"MEMSTATS"`                            // MemStats отправлять метрики runtime.MemStats, по умолчанию true
+	Processes           []ProcessConfig     `env:"PROCESSES" envSeparator:";"`          // Processes отслеживаемые процессы, разделитель ";"
+	CgroupRoot          string              `env:"CGROUP_ROOT"`                         // CgroupRoot точка монтирования cgroup, по умолчанию /sys/fs/cgroup
+	PrometheusTargets   []string            `env:"PROMETHEUS_TARGETS" envSeparator:","` // PrometheusTargets адреса эндпоинтов /metrics в формате Prometheus
+	StatsDAddress       string              `env:"STATSD_ADDRESS"`                      // StatsDAddress UDP адрес приема StatsD метрик, например 127.0.0.1:8125. Пустой - прием отключен
+	PushAddress         string              `env:"PUSH_ADDRESS"`                        // PushAddress loopback адрес HTTP приема метрик от приложений, например 127.0.0.1:8090. Пустой - прием отключен
+	Aggregations        []AggregationConfig `env:"AGGREGATIONS" envSeparator:";"`       // Aggregations агрегаты gauge метрик за окно отправки, разделитель ";"
+	OutboxDir           string              `env:"OUTBOX_DIR"`                          // OutboxDir каталог для неотправленных пакетов метрик. Пустой - пакеты при ошибке отправки теряются
+	OutboxMaxSize       int64               `env:"OUTBOX_MAX_SIZE"`                     // OutboxMaxSize ограничение размера каталога OutboxDir в байтах, по умолчанию 64 МБ
+	RateLimit           int                 `env:"RATE_LIMIT"`                          // RateLimit количество одновременных отправок на сервер, по умолчанию 1, с очередью outbox - всегда 1
+	UploadQueueSize     int                 `env:"UPLOAD_QUEUE_SIZE"`                   // UploadQueueSize размер очереди пакетов, ожидающих отправки, по умолчанию 10
+	OverflowPolicy      string              `env:"UPLOAD_OVERFLOW_POLICY"`              // OverflowPolicy политика переполнения очереди: drop_oldest (по умолчанию), drop_newest или block
+	HealthCheckInterval time.Duration       `env:"HEALTH_CHECK_INTERVAL"`               // HealthCheckInterval интервал проверки доступности адресов сервера из списка, по умолчанию 10 секунд
+	AgentID             string              `env:"AGENT_ID"`                            // AgentID идентификатор агента на сервере. Пустой - <hostname>-<uuid>, сохраняется в AgentIDFile
+	AgentIDFile         string              `env:"AGENT_ID_FILE"`                       // AgentIDFile файл сгенерированного идентификатора, по умолчанию <UserConfigDir>/devmetrics/agent_id
+	Labels              map[string]string   `env:"AGENT_LABELS" envSeparator:","`       // Labels статические метки агента, например env:prod,dc:msk,role:db
+	Sink                string              `env:"SINK"`                                // Sink локальный вывод вместо сервера по умолчанию: stdout, stdout:json или file:<путь>
+	Once                bool                `env:"ONCE"`                                // Once собрать метрики один раз, отправить и завершить работу
+	Disk                DiskConfig          // Disk настройки сбора дисковых метрик
+	Network             NetworkConfig       // Network настройки сбора сетевых метрик
+	Exec                []ExecConfig        // Exec внешние команды для сбора метрик, задаются только в JSON конфигурации
+	LogTail             LogTailConfig       // LogTail файлы логов для сбора метрик, задаются только в JSON конфигурации
+	Relabel             []RelabelConfig     // Relabel правила фильтрации и переименования метрик перед отправкой, задаются только в JSON конфигурации
+	Retry               RetryConfig         // Retry политика повторной отправки пакета после временных ошибок
+	Destinations        []DestinationConfig // Destinations серверы для отправки метрик, задаются только в JSON конфигурации
+}
+
+// DestinationConfig сервер, на который агент отправляет метрики. Каждый сервер получает метрики независимо от остальных
+type DestinationConfig struct {
+	Name       string      // Name имя сервера в логах, также подкаталог очереди OutboxDir
+	Protocol   string      // Protocol протокол передачи http или grpc, либо локальный вывод stdout или file
+	Address    string      // Address адрес сервера host:port или список адресов через запятую в порядке приоритета
+	HashKey    string      // HashKey ключ подписи метрик. Если пустой - метрики не подписываются
+	CryptoKey  string      // CryptoKey путь до файла с публичным ключом, используется только для http
+	Retry      RetryConfig // Retry политика повторной отправки
+	Format     string      // Format формат вывода stdout: pretty (по умолчанию) или json - JSON объект на строку
+	Path       string      // Path путь к NDJSON файлу для file
+	MaxSize    int64       // MaxSize размер файла file в байтах, после которого он ротируется, по умолчанию 10 МБ
+	MaxBackups int         // MaxBackups количество хранимых ротированных файлов <Path>.1 ... <Path>.N, по умолчанию 3
+
+	retry *RetryDummy // retry параметры повторной отправки из JSON, применяются поверх Agent.Retry после переменных окружения
+}
+
+// destinationName допустимое имя сервера: используется как подкаталог очереди и в идентификаторах метрик
+var destinationName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Протоколы локального вывода метрик вместо отправки на сервер
+const (
+	SinkStdout = "stdout" // SinkStdout вывод в стандартный поток вывода
+	SinkFile   = "file"   // SinkFile дозапись в NDJSON файл с ротацией
+)
+
+// ParseSink разбирает локальный вывод из строки: stdout, stdout:json или file:<путь>
+func ParseSink(spec string) (DestinationConfig, error) {
+	kind, arg, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	switch kind {
+	case SinkStdout:
+		if arg != "" && arg != "pretty" && arg != "json" {
+			return DestinationConfig{}, fmt.Errorf("invalid sink %q: unknown stdout format %q", spec, arg)
+		}
+		return DestinationConfig{Name: SinkStdout, Protocol: SinkStdout, Format: arg}, nil
+	case SinkFile:
+		if arg == "" {
+			return DestinationConfig{}, fmt.Errorf("invalid sink %q: file path is empty", spec)
+		}
+		return DestinationConfig{Name: SinkFile, Protocol: SinkFile, Path: arg}, nil
+	default:
+		return DestinationConfig{}, fmt.Errorf("invalid sink %q: expected stdout, stdout:json or file:<path>", spec)
+	}
+}
+
+// RetryConfig политика повторной отправки пакета после временных ошибок
+type RetryConfig struct {
+	MaxAttempts    int           `env:"RETRY_MAX_ATTEMPTS"`    // MaxAttempts максимальное количество попыток, по умолчанию 3
+	InitialBackoff time.Duration `env:"RETRY_INITIAL_BACKOFF"` // InitialBackoff пауза перед первым повтором, далее удваивается, по умолчанию 500ms
+	MaxBackoff     time.Duration `env:"RETRY_MAX_BACKOFF"`     // MaxBackoff максимальная пауза между попытками, по умолчанию 5s
+	Jitter         float64       `env:"RETRY_JITTER"`          // Jitter доля случайного отклонения паузы от 0 до 1, по умолчанию 0.2
+	Deadline       time.Duration `env:"RETRY_DEADLINE"`        // Deadline общее ограничение времени всех попыток, по умолчанию 10s
+}
+
+// DiskConfig настройки сбора дисковых метрик.
+// Списки содержат шаблоны path.Match, пустой MountpointsInclude - все точки монтирования
+type DiskConfig struct {
+	MountpointsInclude []string `env:"DISK_MOUNTPOINTS_INCLUDE" envSeparator:","` // MountpointsInclude опрашиваемые точки монтирования
+	MountpointsExclude []string `env:"DISK_MOUNTPOINTS_EXCLUDE" envSeparator:","` // MountpointsExclude исключенные точки монтирования
+}
+
+// NetworkConfig настройки сбора сетевых метрик.
+// Списки содержат шаблоны path.Match, пустой InterfacesInclude - все интерфейсы
+type NetworkConfig struct {
+	InterfacesInclude []string `env:"NET_INTERFACES_INCLUDE" envSeparator:","` // InterfacesInclude опрашиваемые интерфейсы
+	InterfacesExclude []string `env:"NET_INTERFACES_EXCLUDE" envSeparator:","` // InterfacesExclude исключенные интерфейсы
+}
+
+// ProcessConfig описание отслеживаемого процесса.
+// Задается строкой <label>=<способ>:<значение>, где способ один из:
+// pidfile - путь к PID файлу, name - точное имя процесса, cmdline - регулярное выражение для командной строки.
+// Например: nginx=pidfile:/run/nginx.pid, db=name:postgres, kafka=cmdline:java.*kafka\.Kafka
+type ProcessConfig struct {
+	Label   string // Label имя процесса в метриках
+	PIDFile string // PIDFile путь к PID файлу
+	Name    string // Name точное имя процесса
+	Cmdline string // Cmdline регулярное выражение для командной строки
+}
+
+// UnmarshalText разбирает описание процесса из строки, используется при загрузке из env и JSON
+func (p *ProcessConfig) UnmarshalText(text []byte) error {
+	label, spec, ok := strings.Cut(strings.TrimSpace(string(text)), "=")
+	if !ok || label == "" {
+		return fmt.Errorf("invalid process %q: expected <label>=<method>:<value>", text)
+	}
+
+	method, value, ok := strings.Cut(spec, ":")
+	if !ok || value == "" {
+		return fmt.Errorf("invalid process %q: expected <label>=<method>:<value>", text)
+	}
+
+	*p = ProcessConfig{Label: label}
+	switch method {
+	case "pidfile":
+		p.PIDFile = value
+	case "name":
+		p.Name = value
+	case "cmdline":
+		if _, err := regexp.Compile(value); err != nil {
+			return fmt.Errorf("invalid process %q cmdline: %w", label, err)
+		}
+		p.Cmdline = value
+	default:
+		return fmt.Errorf("invalid process %q: unknown method %q", label, method)
+	}
+
+	return nil
+}
+
+// ExecConfig внешняя команда для сбора метрик.
+// Команда выводит метрики в stdout построчно "<имя> <gauge|counter> <значение>" или JSON массивом
+type ExecConfig struct {
+	Name     string        // Name имя команды в логах и счетчиках ошибок
+	Command  string        // Command путь к исполняемому файлу
+	Args     []string      // Args аргументы команды
+	Interval time.Duration // Interval интервал запуска, по умолчанию PollInterval
+	Timeout  time.Duration // Timeout ограничение времени работы, по умолчанию Interval
+}
+
+// AggregationConfig агрегаты gauge метрик, имена которых подходят под шаблон path.Match.
+// Задается строкой <шаблон>=<агрегат>,<агрегат>, где агрегат один из min, max, avg, last, count, p50, p95, p99.
+// Например: CPUutilization*=max,avg,p95
+type AggregationConfig struct {
+	Pattern    string   // Pattern шаблон имени метрики
+	Aggregates []string // Aggregates отправляемые агрегаты
+}
+
+// aggregates допустимые агрегаты
+var aggregates = map[string]bool{
+	"min": true, "max": true, "avg": true, "last": true, "count": true, "p50": true, "p95": true, "p99": true,
+}
+
+// UnmarshalText разбирает описание агрегации из строки, используется при загрузке из env и JSON
+func (a *AggregationConfig) UnmarshalText(text []byte) error {
+	pattern, list, ok := strings.Cut(strings.TrimSpace(string(text)), "=")
+	if !ok || pattern == "" || list == "" {
+		return fmt.Errorf("invalid aggregation %q: expected <pattern>=<aggregate>,<aggregate>", text)
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid aggregation %q pattern: %w", pattern, err)
+	}
+
+	*a = AggregationConfig{Pattern: pattern}
+	for _, aggregate := range strings.Split(list, ",") {
+		aggregate = strings.TrimSpace(aggregate)
+		if !aggregates[aggregate] {
+			return fmt.Errorf("invalid aggregation %q: unknown aggregate %q", pattern, aggregate)
+		}
+		a.Aggregates = append(a.Aggregates, aggregate)
+	}
+
+	return nil
+}
+
+// LogTailConfig настройки чтения файлов логов
+type LogTailConfig struct {
+	OffsetsFile string          `json:"offsets_file,omitempty"` // OffsetsFile файл сохранения позиций чтения между перезапусками, пустой - позиции не сохраняются
+	Files       []LogFileConfig `json:"files,omitempty"`        // Files отслеживаемые файлы
+}
+
+// LogFileConfig отслеживаемый файл лога
+type LogFileConfig struct {
+	Path          string          `json:"path"`                     // Path путь к файлу
+	FromBeginning bool            `json:"from_beginning,omitempty"` // FromBeginning читать файл с начала при первом запуске, по умолчанию с конца
+	Rules         []LogRuleConfig `json:"rules"`                    // Rules правила извлечения метрик
+}
+
+// LogRuleConfig правило извлечения метрики из строки лога.
+// Name может ссылаться на именованные группы Regex: HTTP_${status}.
+// counter увеличивается на 1 за каждую подходящую строку или на значение группы Value,
+// gauge устанавливается в значение группы Value
+type LogRuleConfig struct {
+	Name  string `json:"name"`            // Name имя метрики
+	Regex string `json:"regex"`           // Regex регулярное выражение для строки
+	Type  string `json:"type"`            // Type gauge или counter
+	Value string `json:"value,omitempty"` // Value имя группы со значением
+}
+
+// Compile проверяет правило и возвращает его регулярное выражение.
+// Для gauge группа Value обязательна, заданная группа должна быть в выражении
+func (rule LogRuleConfig) Compile() (*regexp.Regexp, error) {
+	if rule.Name == "" {
+		return nil, errors.New("name is empty")
+	}
+	regex, err := regexp.Compile(rule.Regex)
+	if err != nil {
+		return nil, err
+	}
+
+	switch rule.Type {
+	case "counter":
+	case "gauge":
+		if rule.Value == "" {
+			return nil, errors.New("gauge requires value group")
+		}
+	default:
+		return nil, fmt.Errorf("unknown metric type %q", rule.Type)
+	}
+
+	if rule.Value != "" && regex.SubexpIndex(rule.Value) < 0 {
+		return nil, fmt.Errorf("value group %q not found in regex", rule.Value)
+	}
+	return regex, nil
+}
+
+// RelabelConfig правило фильтрации или переименования метрик. Правила применяются по порядку перед отправкой.
+// Regex проверяется на совпадение со всем именем метрики.
+// Action одно из: include - оставить только подходящие метрики, exclude - удалить подходящие,
+// rename - заменить имя на Replacement с группами ${1} или ${name}, prefix - добавить Prefix к подходящим
+// (без Regex - ко всем), drop_type - удалить подходящие метрики типа Type (без Regex - все метрики типа)
+type RelabelConfig struct {
+	Action      string `json:"action"`                // Action действие правила
+	Regex       string `json:"regex,omitempty"`       // Regex регулярное выражение для имени метрики
+	Replacement string `json:"replacement,omitempty"` // Replacement новое имя для rename
+	Prefix      string `json:"prefix,omitempty"`      // Prefix префикс для prefix
+	Type        string `json:"type,omitempty"`        // Type gauge или counter для drop_type
+}
+
+// Действия правил фильтрации и переименования метрик
+const (
+	RelabelInclude  = "include"   // RelabelInclude оставить только метрики, имя которых подходит под Regex
+	RelabelExclude  = "exclude"   // RelabelExclude удалить метрики, имя которых подходит под Regex
+	RelabelRename   = "rename"    // RelabelRename переименовать метрики по Regex в Replacement, доступны группы ${1}, ${name}
+	RelabelPrefix   = "prefix"    // RelabelPrefix добавить Prefix к имени метрик, подходящих под Regex (пустой Regex - все метрики)
+	RelabelDropType = "drop_type" // RelabelDropType удалить метрики типа Type, подходящие под Regex (пустой Regex - все метрики)
+)
+
+// Compile проверяет правило и возвращает выражение, проверяющее совпадение со всем именем метрики.
+// Для правила без Regex возвращается nil
+func (rule RelabelConfig) Compile() (*regexp.Regexp, error) {
+	var regex *regexp.Regexp
+	if rule.Regex != "" {
+		compiled, err := regexp.Compile("^(?:" + rule.Regex + ")$")
+		if err != nil {
+			return nil, err
+		}
+		regex = compiled
+	}
+
+	switch rule.Action {
+	case RelabelInclude, RelabelExclude, RelabelRename:
+		if regex == nil {
+			return nil, fmt.Errorf("%v requires regex", rule.Action)
+		}
+	case RelabelPrefix:
+		if rule.Prefix == "" {
+			return nil, errors.New("prefix is empty")
+		}
+	case RelabelDropType:
+		if rule.Type != "gauge" && rule.Type != "counter" {
+			return nil, fmt.Errorf("unknown metric type %q", rule.Type)
+		}
+	default:
+		return nil, fmt.Errorf("unknown action %q", rule.Action)
+	}
+
+	return regex, nil
 }
 
 // TransportConfig конфигурация транспорта
 type TransportConfig struct {
 	Protocol    string // Protocol протокол передачи, по умолчанию http
-	AddressHTTP string `env:"ADDRESS"`      // AddressHTTP адрес WEB сервера, по умолчанию 127.0.0.1:8080
-	AddressGRPC string `env:"ADDRESS_GRPC"` // AddressGRPC адрес GRPC сервера
+	AddressHTTP string `env:"ADDRESS"`      // AddressHTTP адрес WEB сервера или список адресов через запятую в порядке приоритета, по умолчанию 127.0.0.1:8080
+	AddressGRPC string `env:"ADDRESS_GRPC"` // AddressGRPC адрес GRPC сервера или список адресов через запятую в порядке приоритета
 	URLTemplate string // URLTemplate шаблон, по умолчанию %v://%v/
 	ContentType string // ContentType по умолчанию application/json
 }
@@ -63,23 +439,165 @@ func NewConfig(logger logger.Logger) *Config {
 		logger: logger,
 	}
 
+	config.parseFlags()
+	if err := config.load(); err != nil {
+		logger.Fatal("Can't load agent configuration", err)
+	}
+	if err := config.Validate(); err != nil {
+		logger.Fatal("Invalid agent configuration", err)
+	}
+	return &config
+}
+
+// Reload повторно загружает конфигурацию из JSON, флагов и переменных окружения и проверяет её.
+// Флаги разбираются при запуске агента, поэтому NewConfig должен быть вызван раньше.
+// Ошибки загрузки и проверки возвращаются, а не завершают программу
+func Reload(logger logger.Logger) (*Config, error) {
+	config := Config{
+		logger: logger,
+	}
+
+	if err := config.load(); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// load загрузка конфигурации: значения по умолчанию, JSON, флаги, переменные окружения
+func (config *Config) load() error {
 	// конфигурация по умолчанию
 	config.loadAgentConfig()
 	config.loadHTTPConfig()
 
-	config.parseFlags()
-	config.loadJSONConfiguration()
+	if err := config.loadJSONConfiguration(); err != nil {
+		return err
+	}
 	config.loadAgentFlags()
-	config.loadAgentEnvConfiguration()
+	if err := config.loadAgentEnvConfiguration(); err != nil {
+		return err
+	}
 	config.selectProtocol() // Если передан адрес GRPC используем его в качестве транспорта
-	return &config
+	config.resolveAgentID()
+	config.resolveDestinationRetry()
+	return nil
+}
+
+// resolveDestinationRetry задает серверам из JSON итоговую политику повторной отправки:
+// Agent.Retry с учетом флагов и переменных окружения RETRY_*, поверх которой применяются параметры сервера из JSON
+func (config *Config) resolveDestinationRetry() {
+	for i := range config.Agent.Destinations {
+		destination := &config.Agent.Destinations[i]
+		destination.Retry = config.Agent.Retry
+		if destination.retry != nil {
+			destination.Retry = applyRetryJSON(destination.Retry, *destination.retry)
+		}
+	}
+}
+
+// Validate проверка значений, без которых агент не может собирать и отправлять метрики
+func (config *Config) Validate() error {
+	if config.Agent.PollInterval <= 0 {
+		return fmt.Errorf("poll interval must be positive, got %v", config.Agent.PollInterval)
+	}
+	if config.Agent.ReportInterval <= 0 {
+		return fmt.Errorf("report interval must be positive, got %v", config.Agent.ReportInterval)
+	}
+	if config.Agent.RateLimit < 1 {
+		return fmt.Errorf("rate limit must be at least 1, got %v", config.Agent.RateLimit)
+	}
+	if config.Agent.UploadQueueSize < 1 {
+		return fmt.Errorf("upload queue size must be at least 1, got %v", config.Agent.UploadQueueSize)
+	}
+
+	if config.Agent.Sink != "" && len(config.Agent.Destinations) == 0 {
+		if _, err := ParseSink(config.Agent.Sink); err != nil {
+			return err
+		}
+	}
+
+	for i, execConfig := range config.Agent.Exec {
+		if execConfig.Name == "" {
+			return fmt.Errorf("exec %d: name is empty", i)
+		}
+		if execConfig.Command == "" {
+			return fmt.Errorf("exec %v: command is empty", execConfig.Name)
+		}
+		if execConfig.Interval < 0 || execConfig.Timeout < 0 {
+			return fmt.Errorf("exec %v: interval and timeout must not be negative", execConfig.Name)
+		}
+	}
+
+	for _, file := range config.Agent.LogTail.Files {
+		if file.Path == "" {
+			return errors.New("log file path is empty")
+		}
+		for i, rule := range file.Rules {
+			if _, err := rule.Compile(); err != nil {
+				return fmt.Errorf("log %v rule %d: %w", file.Path, i, err)
+			}
+		}
+	}
+
+	for i, rule := range config.Agent.Relabel {
+		if _, err := rule.Compile(); err != nil {
+			return fmt.Errorf("relabel rule %d: %w", i, err)
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, destination := range config.UploadDestinations() {
+		if !destinationName.MatchString(destination.Name) {
+			return fmt.Errorf("destination %q: name must match %v", destination.Name, destinationName)
+		}
+		if names[destination.Name] {
+			return fmt.Errorf("destination %v: duplicate name", destination.Name)
+		}
+		names[destination.Name] = true
+
+		switch destination.Protocol {
+		case "http", "grpc":
+			if strings.Trim(destination.Address, ", ") == "" {
+				return fmt.Errorf("destination %v: address is empty", destination.Name)
+			}
+		case SinkStdout:
+			if destination.Format != "" && destination.Format != "pretty" && destination.Format != "json" {
+				return fmt.Errorf("destination %v: unknown stdout format %q", destination.Name, destination.Format)
+			}
+		case SinkFile:
+			if destination.Path == "" {
+				return fmt.Errorf("destination %v: file path is empty", destination.Name)
+			}
+		default:
+			return fmt.Errorf("destination %v: unknown protocol %q", destination.Name, destination.Protocol)
+		}
+	}
+
+	return nil
 }
 
 // loadHTTPConfig загрузка конфигурации опроса и отправки по умолчанию
 func (config *Config) loadAgentConfig() {
 	config.Agent = AgentConfig{
-		PollInterval:   2 * time.Second,
-		ReportInterval: 10 * time.Second,
+		PollInterval:        2 * time.Second,
+		ReportInterval:      10 * time.Second,
+		MemStats:            true,
+		CgroupRoot:          "/sys/fs/cgroup",
+		OutboxMaxSize:       64 << 20,
+		RateLimit:           1,
+		UploadQueueSize:     10,
+		OverflowPolicy:      "drop_oldest",
+		HealthCheckInterval: 10 * time.Second,
+		AgentIDFile:         defaultAgentIDFile(),
+		Retry: RetryConfig{
+			MaxAttempts:    3,
+			InitialBackoff: 500 * time.Millisecond,
+			MaxBackoff:     5 * time.Second,
+			Jitter:         0.2,
+			Deadline:       10 * time.Second,
+		},
 	}
 }
 
@@ -104,6 +622,9 @@ func (config *Config) parseFlags() {
 	pollInterval = flag.Duration("p", 2*time.Second, "Metrics pool interval.")
 	hashKey = flag.String("k", "", "Key for metrics sign")
 	cryptoKey = flag.String("crypto-key", "", "Path to public PEM key")
+	rateLimit = flag.Int("l", 1, "Max concurrent uploads to the server.")
+	sink = flag.String("sink", "", "Print metrics instead of uploading: stdout, stdout:json or file:<path>.")
+	once = flag.Bool("once", false, "Collect metrics once, ship them and exit.")
 
 	flag.Parse()
 }
@@ -133,19 +654,31 @@ func (config *Config) loadAgentFlags() {
 	if isFlagPassed("crypto-key") {
 		config.Agent.CryptoKey = *cryptoKey
 	}
+
+	if isFlagPassed("l") {
+		config.Agent.RateLimit = *rateLimit
+	}
+
+	if isFlagPassed("sink") {
+		config.Agent.Sink = *sink
+	}
+
+	if isFlagPassed("once") {
+		config.Agent.Once = *once
+	}
 }
 
 // loadJSONConfiguration извлекает путь к JSON конфигу из флагов -c -config или переменной окружения CONFIG
 // Открывает файл и загружает конфигурацию. У JSON конфигурации самый низкий приоритет
 // конфигурация может быть в дальнейшем перезаписана данными из флагов и переменных окружения
-// Ошибки открытия файла или парсинга конфигурации приведут к остановке программы
-func (config *Config) loadJSONConfiguration() {
+// Возвращает ошибки открытия файла или парсинга конфигурации
+func (config *Config) loadJSONConfiguration() error {
 	var (
 		JSONConfigPath string
 		dummy          ConfDummy
 	)
 
-	if *jsonConf != "" {
+	if jsonConf != nil && *jsonConf != "" {
 		JSONConfigPath = *jsonConf
 	}
 
@@ -155,53 +688,201 @@ func (config *Config) loadJSONConfiguration() {
 
 	// если путь к файлу не предоставлен, завершаем работу метода
 	if JSONConfigPath == "" {
-		return
+		return nil
 	}
 
 	cFile, err := os.Open(JSONConfigPath)
 	if err != nil {
-		config.logger.Fatal("loadJSONConfiguration os.Open error", err)
+		return fmt.Errorf("loadJSONConfiguration os.Open: %w", err)
 	}
 
 	defer func(cFile *os.File) {
 		cErr := cFile.Close()
 		if cErr != nil {
-			config.logger.Fatal("loadJSONConfiguration cFile.Close error", cErr)
+			config.logger.Error("loadJSONConfiguration cFile.Close error", cErr)
 		}
 	}(cFile)
 
 	d := json.NewDecoder(cFile)
 	dErr := d.Decode(&dummy)
 	if dErr != nil {
-		config.logger.Fatal("loadJSONConfiguration json.Decode error", err)
+		return fmt.Errorf("loadJSONConfiguration json.Decode: %w", dErr)
 	}
 
 	config.Transport.AddressHTTP = dummy.Address
 	config.Transport.AddressGRPC = dummy.AddressGRPC
 	config.Agent.CryptoKey = dummy.CryptoKey
+	config.Agent.Disk.MountpointsInclude = dummy.DiskMountpointsInclude
+	config.Agent.Disk.MountpointsExclude = dummy.DiskMountpointsExclude
+	config.Agent.Network.InterfacesInclude = dummy.NetInterfacesInclude
+	config.Agent.Network.InterfacesExclude = dummy.NetInterfacesExclude
+	config.Agent.Processes = dummy.Processes
+	config.Agent.PrometheusTargets = dummy.PrometheusTargets
+	config.Agent.StatsDAddress = dummy.StatsDAddress
+	config.Agent.PushAddress = dummy.PushAddress
+	config.Agent.LogTail = dummy.LogTail
+	config.Agent.Aggregations = dummy.Aggregations
+	config.Agent.Relabel = dummy.Relabel
+	config.Agent.AgentID = dummy.AgentID
+	if dummy.AgentIDFile != "" {
+		config.Agent.AgentIDFile = dummy.AgentIDFile
+	}
+	config.Agent.Labels = dummy.Labels
+	config.Agent.Sink = dummy.Sink
+	config.Agent.OutboxDir = dummy.OutboxDir
+	config.Agent.Exec = make([]ExecConfig, 0, len(dummy.Exec))
+	for _, execDummy := range dummy.Exec {
+		execConfig, err := parseExec(execDummy)
+		if err != nil {
+			return fmt.Errorf("loadJSONConfiguration: %w", err)
+		}
+		config.Agent.Exec = append(config.Agent.Exec, execConfig)
+	}
+
+	if dummy.CgroupRoot != "" {
+		config.Agent.CgroupRoot = dummy.CgroupRoot
+	}
+	if dummy.OutboxMaxSize > 0 {
+		config.Agent.OutboxMaxSize = dummy.OutboxMaxSize
+	}
+	if dummy.RateLimit > 0 {
+		config.Agent.RateLimit = dummy.RateLimit
+	}
+	if dummy.UploadQueueSize > 0 {
+		config.Agent.UploadQueueSize = dummy.UploadQueueSize
+	}
+	if dummy.OverflowPolicy != "" {
+		config.Agent.OverflowPolicy = dummy.OverflowPolicy
+	}
+	if parsed, err := time.ParseDuration(dummy.HealthCheckInterval); err == nil {
+		config.Agent.HealthCheckInterval = parsed
+	}
+	if dummy.Retry != nil {
+		config.Agent.Retry = applyRetryJSON(config.Agent.Retry, *dummy.Retry)
+	}
+	config.Agent.Destinations = make([]DestinationConfig, 0, len(dummy.Destinations))
+	for _, destinationDummy := range dummy.Destinations {
+		destination := DestinationConfig{
+			Name:       destinationDummy.Name,
+			Protocol:   destinationDummy.Protocol,
+			Address:    destinationDummy.Address,
+			HashKey:    destinationDummy.HashKey,
+			CryptoKey:  destinationDummy.CryptoKey,
+			Format:     destinationDummy.Format,
+			Path:       destinationDummy.Path,
+			MaxSize:    destinationDummy.MaxSize,
+			MaxBackups: destinationDummy.MaxBackups,
+			retry:      destinationDummy.Retry,
+		}
+		if destination.Protocol == "" {
+			destination.Protocol = "http"
+		}
+		config.Agent.Destinations = append(config.Agent.Destinations, destination)
+	}
+	if dummy.MemStats != nil {
+		config.Agent.MemStats = *dummy.MemStats
+	}
 
-	parsedReportInterval, _ := time.ParseDuration(dummy.ReportInterval)
-	config.Agent.ReportInterval = parsedReportInterval
+	// не заданные в JSON интервалы остаются по умолчанию
+	if parsedReportInterval, err := time.ParseDuration(dummy.ReportInterval); err == nil {
+		config.Agent.ReportInterval = parsedReportInterval
+	}
 
-	parsedPoolInterval, _ := time.ParseDuration(dummy.PollInterval)
-	config.Agent.PollInterval = parsedPoolInterval
+	if parsedPoolInterval, err := time.ParseDuration(dummy.PollInterval); err == nil {
+		config.Agent.PollInterval = parsedPoolInterval
+	}
 
 	config.logger.Info("JSON configuration loaded")
+	return nil
+}
+
+// parseExec описание внешней команды из JSON конфигурации.
+// Не заданные интервалы остаются нулевыми и заменяются значениями по умолчанию при запуске команды.
+// Возвращает ошибку разбора Interval или Timeout
+func parseExec(dummy ExecDummy) (ExecConfig, error) {
+	execConfig := ExecConfig{
+		Name:    dummy.Name,
+		Command: dummy.Command,
+		Args:    dummy.Args,
+	}
+
+	var err error
+	if dummy.Interval != "" {
+		if execConfig.Interval, err = time.ParseDuration(dummy.Interval); err != nil {
+			return ExecConfig{}, fmt.Errorf("exec %v interval: %w", dummy.Name, err)
+		}
+	}
+	if dummy.Timeout != "" {
+		if execConfig.Timeout, err = time.ParseDuration(dummy.Timeout); err != nil {
+			return ExecConfig{}, fmt.Errorf("exec %v timeout: %w", dummy.Name, err)
+		}
+	}
+	return execConfig, nil
+}
+
+// applyRetryJSON применяет к политике base заданные в JSON параметры повторной отправки
+func applyRetryJSON(base RetryConfig, dummy RetryDummy) RetryConfig {
+	if dummy.MaxAttempts > 0 {
+		base.MaxAttempts = dummy.MaxAttempts
+	}
+	if parsed, err := time.ParseDuration(dummy.InitialBackoff); err == nil {
+		base.InitialBackoff = parsed
+	}
+	if parsed, err := time.ParseDuration(dummy.MaxBackoff); err == nil {
+		base.MaxBackoff = parsed
+	}
+	if dummy.Jitter > 0 {
+		base.Jitter = dummy.Jitter
+	}
+	if parsed, err := time.ParseDuration(dummy.Deadline); err == nil {
+		base.Deadline = parsed
+	}
+	return base
+}
+
+// UploadDestinations серверы для отправки метрик.
+// Если список Agent.Destinations пуст, возвращается локальный вывод Agent.Sink,
+// а если он не задан - один сервер default из параметров Transport, Agent.HashKey, Agent.CryptoKey и Agent.Retry
+func (config *Config) UploadDestinations() []DestinationConfig {
+	if len(config.Agent.Destinations) > 0 {
+		return config.Agent.Destinations
+	}
+
+	if config.Agent.Sink != "" {
+		// ошибка разбора возвращается из Validate
+		destination, _ := ParseSink(config.Agent.Sink)
+		return []DestinationConfig{destination}
+	}
+
+	address := config.Transport.AddressHTTP
+	if config.Transport.Protocol == "grpc" {
+		address = config.Transport.AddressGRPC
+	}
+
+	return []DestinationConfig{{
+		Name:      "default",
+		Protocol:  config.Transport.Protocol,
+		Address:   address,
+		HashKey:   config.Agent.HashKey,
+		CryptoKey: config.Agent.CryptoKey,
+		Retry:     config.Agent.Retry,
+	}}
 }
 
 // loadAgentEnvConfiguration загрузка конфигурации переменных окружения
-func (config *Config) loadAgentEnvConfiguration() {
+func (config *Config) loadAgentEnvConfiguration() error {
 	config.logger.Info("Load env configuration")
 
 	err := env.Parse(&config.Transport)
 	if err != nil {
-		config.logger.Fatal("loadAgentEnvConfiguration env.Parse config.Transport", err)
+		return fmt.Errorf("loadAgentEnvConfiguration env.Parse config.Transport: %w", err)
 	}
 
 	err = env.Parse(&config.Agent)
 	if err != nil {
-		config.logger.Fatal("loadAgentEnvConfiguration env.Parse config.Agent", err)
+		return fmt.Errorf("loadAgentEnvConfiguration env.Parse config.Agent: %w", err)
 	}
+	return nil
 }
 
 func (config *Config) selectProtocol() {
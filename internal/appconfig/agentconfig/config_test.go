@@ -0,0 +1,115 @@
+package agentconfig
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseExec(t *testing.T) {
+	execConfig, err := parseExec(ExecDummy{Name: "queue", Command: "/bin/queue", Interval: "30s"})
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, execConfig.Interval)
+	// не заданный timeout заменяется значением по умолчанию при запуске команды
+	assert.Zero(t, execConfig.Timeout)
+
+	_, err = parseExec(ExecDummy{Name: "queue", Command: "/bin/queue", Interval: "30"})
+	assert.Error(t, err)
+	_, err = parseExec(ExecDummy{Name: "queue", Command: "/bin/queue", Timeout: "fast"})
+	assert.Error(t, err)
+}
+
+func TestConfig_Validate_Exec(t *testing.T) {
+	tests := []struct {
+		name    string
+		exec    ExecConfig
+		wantErr bool
+	}{
+		{"valid", ExecConfig{Name: "queue", Command: "/bin/queue"}, false},
+		{"empty name", ExecConfig{Command: "/bin/queue"}, true},
+		{"empty command", ExecConfig{Name: "queue"}, true},
+		{"negative timeout", ExecConfig{Name: "queue", Command: "/bin/queue", Timeout: -time.Second}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{}
+			config.loadAgentConfig()
+			config.Agent.Sink = SinkStdout
+			config.Agent.Exec = []ExecConfig{tt.exec}
+			assert.Equal(t, tt.wantErr, config.Validate() != nil)
+		})
+	}
+}
+
+func TestLogRuleConfig_Compile(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    LogRuleConfig
+		wantErr bool
+	}{
+		{"counter", LogRuleConfig{Name: "Errors", Regex: `level=error`, Type: "counter"}, false},
+		{"gauge", LogRuleConfig{Name: "Latency", Regex: `rt=(?P<rt>[0-9.]+)`, Type: "gauge", Value: "rt"}, false},
+		{"empty name", LogRuleConfig{Regex: `level=error`, Type: "counter"}, true},
+		{"invalid regex", LogRuleConfig{Name: "Errors", Regex: `level=(`, Type: "counter"}, true},
+		{"unknown type", LogRuleConfig{Name: "Errors", Regex: `level=error`, Type: "histogram"}, true},
+		{"gauge without value", LogRuleConfig{Name: "Latency", Regex: `rt=(?P<rt>[0-9.]+)`, Type: "gauge"}, true},
+		{"missing value group", LogRuleConfig{Name: "Latency", Regex: `rt=([0-9.]+)`, Type: "gauge", Value: "rt"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.rule.Compile()
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+
+	// правило с ошибкой не позволяет запустить агента
+	config := &Config{}
+	config.loadAgentConfig()
+	config.Agent.Sink = SinkStdout
+	config.Agent.LogTail.Files = []LogFileConfig{{Path: "/var/log/app.log", Rules: []LogRuleConfig{tests[3].rule}}}
+	assert.Error(t, config.Validate())
+}
+
+func TestConfig_Validate_DestinationNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   []string
+		wantErr bool
+	}{
+		{"valid", []string{"primary", "backup_2", "dc-1"}, false},
+		{"empty", []string{""}, true},
+		{"path", []string{"../outbox"}, true},
+		{"space", []string{"dc 1"}, true},
+		{"duplicate", []string{"primary", "primary"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{}
+			config.loadAgentConfig()
+			for _, name := range tt.names {
+				config.Agent.Destinations = append(config.Agent.Destinations,
+					DestinationConfig{Name: name, Protocol: "http", Address: "localhost:8080"})
+			}
+			assert.Equal(t, tt.wantErr, config.Validate() != nil)
+		})
+	}
+}
+
+func TestConfig_resolveDestinationRetry(t *testing.T) {
+	config := &Config{}
+	config.loadAgentConfig()
+	config.Agent.Destinations = []DestinationConfig{
+		{Name: "primary"},
+		{Name: "backup", retry: &RetryDummy{MaxAttempts: 7}},
+	}
+	// значения из переменных окружения загружаются после JSON
+	config.Agent.Retry.MaxAttempts = 5
+	config.Agent.Retry.InitialBackoff = 3 * time.Second
+
+	config.resolveDestinationRetry()
+	assert.Equal(t, config.Agent.Retry, config.Agent.Destinations[0].Retry)
+	assert.Equal(t, 7, config.Agent.Destinations[1].Retry.MaxAttempts)
+	assert.Equal(t, 3*time.Second, config.Agent.Destinations[1].Retry.InitialBackoff)
+}
@@ -0,0 +1,76 @@
+package agentconfig
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultAgentIDFile путь к файлу идентификатора агента по умолчанию
+func defaultAgentIDFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "devmetrics_agent_id"
+	}
+	return filepath.Join(dir, "devmetrics", "agent_id")
+}
+
+// resolveAgentID определяет идентификатор агента, если он не задан в конфигурации.
+// Идентификатор читается из AgentIDFile, при отсутствии файла генерируется <hostname>-<uuid> и сохраняется в файл.
+// Если сохранить идентификатор не удалось, он действует до перезапуска агента
+func (config *Config) resolveAgentID() {
+	if config.Agent.AgentID != "" {
+		return
+	}
+
+	id, err := loadAgentID(config.Agent.AgentIDFile)
+	if err != nil {
+		config.logger.Error("Can't persist agent ID, it will change after restart", err)
+	}
+	config.Agent.AgentID = id
+	config.logger.Info(fmt.Sprintf("Agent ID: %v", id))
+}
+
+// loadAgentID читает идентификатор из файла filename или создает новый.
+// При ошибке записи возвращается новый идентификатор вместе с ошибкой
+func loadAgentID(filename string) (string, error) {
+	if filename != "" {
+		data, err := os.ReadFile(filename)
+		if id := strings.TrimSpace(string(data)); err == nil && id != "" {
+			return id, nil
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return newAgentID(), err
+		}
+	}
+
+	id := newAgentID()
+	if filename == "" {
+		return id, errors.New("agent ID file is not set")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return id, err
+	}
+
+	return id, os.WriteFile(filename, []byte(id+"\n"), 0o644)
+}
+
+// newAgentID генерирует идентификатор <hostname>-<uuid v4>
+func newAgentID() string {
+	var uuid [16]byte
+	_, _ = rand.Read(uuid[:])
+	uuid[6] = uuid[6]&0x0f | 0x40 // версия 4
+	uuid[8] = uuid[8]&0x3f | 0x80 // вариант RFC 4122
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "agent"
+	}
+
+	return fmt.Sprintf("%s-%x-%x-%x-%x-%x", hostname, uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
@@ -0,0 +1,27 @@
+package agentconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_loadAgentID(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "devmetrics", "agent_id")
+
+	id, err := loadAgentID(filename)
+	require.NoError(t, err)
+
+	hostname, _ := os.Hostname()
+	assert.True(t, strings.HasPrefix(id, hostname+"-"))
+	assert.Len(t, strings.TrimPrefix(id, hostname+"-"), 36)
+
+	// при повторном запуске идентификатор читается из файла
+	again, err := loadAgentID(filename)
+	require.NoError(t, err)
+	assert.Equal(t, id, again)
+}
@@ -84,56 +84,23 @@ func ExampleKeyManager_GenerateKeys() {
 		log.Fatal(err.Error())
 	}
 
-	// Подготовка к сохранению файлов. Создаем папку, определяем пути
-	cwd, err := os.Getwd()
-	keysDir := "/../../.keys"
-
-	keyPath := filepath.Join(cwd, keysDir)
-
-	if _, statErr := os.Stat(keyPath); !os.IsNotExist(statErr) {
-		removeErr := os.RemoveAll(keyPath)
-		if removeErr != nil {
-			log.Fatal("Can't remove keys dir:", removeErr.Error())
-		}
-	}
-
-	err = os.Mkdir(keyPath, os.ModePerm)
+	// Подготовка к сохранению файлов. Создаем временную папку, чтобы ключи не попали в репозиторий
+	keyPath, err := os.MkdirTemp("", "keys")
 	if err != nil {
 		log.Fatal("Can't create keys dir:", err.Error())
 	}
+	defer os.RemoveAll(keyPath)
 
 	// Сохраняем публичный ключ в файл
-	pubPath := filepath.Join(cwd, keysDir, "pub.pem")
-	pub, err := os.Create(pubPath)
-	if err != nil {
-		log.Fatal("Can't create file:", err.Error())
-	}
-	defer func(pub *os.File) {
-		cErr := pub.Close()
-		if cErr != nil {
-			log.Fatal("Can't close pub:", cErr.Error())
-		}
-	}(pub)
-
-	_, err = pub.Write(pubKeyBody)
+	pubPath := filepath.Join(keyPath, "pub.pem")
+	err = os.WriteFile(pubPath, pubKeyBody, 0o600)
 	if err != nil {
 		log.Fatal("Can't write to PUB file:", err.Error())
 	}
 
 	// Сохраняем приватный ключ в файл
-	secretPath := filepath.Join(cwd, keysDir, "secret.pem")
-	secret, err := os.Create(secretPath)
-	if err != nil {
-		log.Fatal("Can't create file:", err.Error())
-	}
-	defer func(secret *os.File) {
-		cErr := secret.Close()
-		if cErr != nil {
-			log.Fatal("Can't close pub:", cErr.Error())
-		}
-	}(secret)
-
-	_, err = secret.Write(privateKeyBody)
+	secretPath := filepath.Join(keyPath, "secret.pem")
+	err = os.WriteFile(secretPath, privateKeyBody, 0o600)
 	if err != nil {
 		log.Fatal("Can't write to SECRET file:", err.Error())
 	}
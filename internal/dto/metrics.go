@@ -8,6 +8,8 @@ type Metrics struct {
 	Delta *int64   `json:"delta,omitempty"` // Delta значение метрики в случае передачи counter
 	Value *float64 `json:"value,omitempty"` // Value значение метрики в случае передачи gauge
 	Hash  string   `json:"hash,omitempty"`  // Hash значение хеш-функции - подпись для проверки подлинности метрики
+	// Source идентификатор агента - источника метрики на сервере. Пустой - общие метрики без источника
+	Source string `json:"source,omitempty"`
 }
 
 // EmptyMetric используется в примерах и документации для запроса значений метрик
@@ -0,0 +1,72 @@
+package dto
+
+import (
+	"net/url"
+	"sort"
+	"time"
+)
+
+// Заголовки HTTP и ключи метаданных GRPC, которыми агент передает свою идентификацию с каждым пакетом метрик
+const (
+	AgentIDHeader        = "X-Agent-ID"        // AgentIDHeader идентификатор агента
+	AgentLabelsHeader    = "X-Agent-Labels"    // AgentLabelsHeader метки агента в формате URL query: dc=msk&env=prod
+	AgentSignatureHeader = "X-Agent-Signature" // AgentSignatureHeader подпись идентификатора и меток агента ключом HashKey
+	CollectedAtHeader    = "X-Collected-At"    // CollectedAtHeader время сбора пакета в формате RFC3339Nano
+)
+
+// Source источник пакета метрик - агент и его статические метки
+type Source struct {
+	AgentID string            // AgentID идентификатор агента, пустой - источник не передан
+	Labels  map[string]string // Labels статические метки агента: env, dc, role
+	// CollectedAt время сбора пакета. Для пакетов из очереди outbox агента - исходное время сбора.
+	// Нулевое - время не передано
+	CollectedAt time.Time
+}
+
+// EncodeLabels кодирует метки для передачи в заголовке AgentLabelsHeader, ключи сортируются
+func (s Source) EncodeLabels() string {
+	keys := make([]string, 0, len(s.Labels))
+	for key := range s.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	values := url.Values{}
+	for _, key := range keys {
+		values.Set(key, s.Labels[key])
+	}
+	return values.Encode()
+}
+
+// SignedData строка идентификации агента, которая подписывается ключом HashKey: <AgentID>:<EncodeLabels>
+func (s Source) SignedData() string {
+	return s.AgentID + ":" + s.EncodeLabels()
+}
+
+// EncodeCollectedAt кодирует время сбора для передачи в заголовке CollectedAtHeader
+func (s Source) EncodeCollectedAt() string {
+	return s.CollectedAt.UTC().Format(time.RFC3339Nano)
+}
+
+// ParseCollectedAt разбирает время сбора из заголовка CollectedAtHeader, при ошибке возвращает нулевое время
+func ParseCollectedAt(header string) time.Time {
+	collectedAt, err := time.Parse(time.RFC3339Nano, header)
+	if err != nil {
+		return time.Time{}
+	}
+	return collectedAt
+}
+
+// ParseLabels разбирает метки из заголовка AgentLabelsHeader, некорректные пары пропускаются
+func ParseLabels(header string) map[string]string {
+	values, _ := url.ParseQuery(header)
+	if len(values) == 0 {
+		return nil
+	}
+
+	labels := make(map[string]string, len(values))
+	for key := range values {
+		labels[key] = values.Get(key)
+	}
+	return labels
+}
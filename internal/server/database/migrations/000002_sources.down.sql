@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS public.sources;
+
+DELETE FROM public.metrics WHERE source <> '';
+ALTER TABLE public.metrics DROP CONSTRAINT IF EXISTS metrics_pkey;
+ALTER TABLE public.metrics DROP COLUMN IF EXISTS source;
+ALTER TABLE public.metrics ADD PRIMARY KEY (id, type);
@@ -0,0 +1,10 @@
+ALTER TABLE public.metrics ADD COLUMN IF NOT EXISTS source VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE public.metrics DROP CONSTRAINT IF EXISTS metrics_pkey;
+ALTER TABLE public.metrics ADD PRIMARY KEY (source, id, type);
+
+CREATE TABLE IF NOT EXISTS public.sources
+(
+    id VARCHAR not null,
+    labels JSONB not null DEFAULT '{}',
+    PRIMARY KEY (id)
+);
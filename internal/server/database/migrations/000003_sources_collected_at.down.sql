@@ -0,0 +1 @@
+ALTER TABLE public.sources DROP COLUMN IF EXISTS collected_at;
@@ -0,0 +1 @@
+ALTER TABLE public.sources ADD COLUMN IF NOT EXISTS collected_at TIMESTAMPTZ;
@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+// GetHealthz проверка доступности сервера без обращения к хранилищу.
+// Используется агентами для выбора адреса сервера
+//
+//	@Tags Info
+//	@Summary Запрос доступности сервера
+//	@Success 200 {string} string ""
+//	@Router /healthz [get]
+func (h *Handler) GetHealthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+}
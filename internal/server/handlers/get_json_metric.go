@@ -9,7 +9,7 @@ import (
 // GetJSONMetric получение метрик POST /value/
 //
 //	@Tags Metrics
-//	@Summary Запрос одной метрики с указанием её типа и имени
+//	@Summary Запрос одной метрики с указанием её типа, имени и, при необходимости, агента source
 //	@Accept  json
 //	@Produce json
 //	@Param metric body dto.EmptyMetric true "Сервис принимает пустую метрику с указанием типа и имени метрики, отдает JSON наполненный данными"
@@ -30,7 +30,7 @@ func (h *Handler) GetJSONMetric() http.HandlerFunc {
 
 		switch metricCandidate.MType {
 		case "gauge":
-			if metricValue, exist := h.storage.GetGauge(metricCandidate.ID); exist {
+			if metricValue, exist := h.storage.GetSourceGauge(metricCandidate.Source, metricCandidate.ID); exist {
 
 				// подписываем метрику если установлен ключ шифрования
 				if h.config.Server.HashKey != "" {
@@ -57,7 +57,7 @@ func (h *Handler) GetJSONMetric() http.HandlerFunc {
 			}
 
 		case "counter":
-			if metricValue, exist := h.storage.GetCounter(metricCandidate.ID); exist {
+			if metricValue, exist := h.storage.GetSourceCounter(metricCandidate.Source, metricCandidate.ID); exist {
 
 				// подписываем метрику если установлен ключ шифрования
 				if h.config.Server.HashKey != "" {
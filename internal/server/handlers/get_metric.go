@@ -14,6 +14,7 @@ import (
 //	@Produce json
 //	@Param metric_type path string true "Тип метрики: counter, gauge"
 //	@Param metric_name path string true "Имя метрики"
+//	@Param agent query string false "Идентификатор агента, по умолчанию общие метрики всех агентов"
 //	@Success 200 {object} dto.Metrics
 //	@Failure 400
 //	@Failure 404
@@ -23,10 +24,11 @@ func (h *Handler) GetMetric() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		metricType := chi.URLParam(r, "metricType")
 		metricTitle := chi.URLParam(r, "metricTitle")
+		source := r.URL.Query().Get("agent")
 
 		switch metricType {
 		case "gauge":
-			if metricValue, exist := h.storage.GetGauge(metricTitle); exist {
+			if metricValue, exist := h.storage.GetSourceGauge(source, metricTitle); exist {
 				w.WriteHeader(http.StatusOK)
 				_, err := fmt.Fprintf(w, "%v", metricValue)
 				if err != nil {
@@ -39,7 +41,7 @@ func (h *Handler) GetMetric() http.HandlerFunc {
 			}
 
 		case "counter":
-			if metricValue, exist := h.storage.GetCounter(metricTitle); exist {
+			if metricValue, exist := h.storage.GetSourceCounter(source, metricTitle); exist {
 				w.WriteHeader(http.StatusOK)
 				_, err := fmt.Fprintf(w, "%v", metricValue)
 				if err != nil {
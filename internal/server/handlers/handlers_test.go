@@ -14,9 +14,11 @@ import (
 	"github.com/stretchr/testify/suite"
 
 	"github.com/atrian/devmetrics/internal/appconfig/serverconfig"
+	"github.com/atrian/devmetrics/internal/dto"
 	"github.com/atrian/devmetrics/internal/server/handlers"
 	"github.com/atrian/devmetrics/internal/server/router"
 	"github.com/atrian/devmetrics/internal/server/storage"
+	"github.com/atrian/devmetrics/internal/signature"
 	"github.com/atrian/devmetrics/pkg/logger"
 )
 
@@ -101,6 +103,57 @@ func (suite *HandlersTestSuite) TestUpdateCounterInSeries() {
 	assert.Equal(suite.T(), "13", body)
 }
 
+func (suite *HandlersTestSuite) TestHealthz() {
+	ts := httptest.NewServer(suite.router)
+	defer ts.Close()
+
+	// доступность проверяется без подключения к БД
+	statusCode, _ := testRequest(suite.T(), ts, "GET", "/healthz")
+	assert.Equal(suite.T(), http.StatusOK, statusCode)
+}
+
+func (suite *HandlersTestSuite) TestUpdateJSONMetrics_AgentSignature() {
+	config := *suite.config
+	config.Server.HashKey = "secret"
+	ts := httptest.NewServer(router.New(handlers.New(&config, suite.storage, suite.logger), nil, &config))
+	defer ts.Close()
+
+	hasher := signature.NewSha256Hasher()
+	delta := int64(4)
+	body := fmt.Sprintf(`[{"id":"SignedCounter","type":"counter","delta":4,"hash":"%s"}]`,
+		hasher.Hash(fmt.Sprintf("SignedCounter:counter:%d", delta), config.Server.HashKey))
+	source := dto.Source{AgentID: "web-1", Labels: map[string]string{"env": "prod"}}
+
+	send := func(sign string) int {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/updates/", strings.NewReader(body))
+		require.NoError(suite.T(), err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(dto.AgentIDHeader, source.AgentID)
+		req.Header.Set(dto.AgentLabelsHeader, source.EncodeLabels())
+		req.Header.Set(dto.AgentSignatureHeader, sign)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(suite.T(), err)
+		require.NoError(suite.T(), resp.Body.Close())
+		return resp.StatusCode
+	}
+
+	// идентификация агента без верной подписи отклоняется
+	assert.Equal(suite.T(), http.StatusForbidden, send(""))
+	assert.Equal(suite.T(), http.StatusForbidden, send(hasher.Hash("web-2:", config.Server.HashKey)))
+
+	assert.Equal(suite.T(), http.StatusOK, send(hasher.Hash(source.SignedData(), config.Server.HashKey)))
+
+	// метрики агента доступны и без параметра agent
+	statusCode, value := testRequest(suite.T(), ts, "GET", "/value/counter/SignedCounter?agent=web-1")
+	assert.Equal(suite.T(), http.StatusOK, statusCode)
+	assert.Equal(suite.T(), "4", value)
+
+	statusCode, value = testRequest(suite.T(), ts, "GET", "/value/counter/SignedCounter")
+	assert.Equal(suite.T(), http.StatusOK, statusCode)
+	assert.Equal(suite.T(), "4", value)
+}
+
 // Для запуска через Go test
 func TestHandlersTestSuite(t *testing.T) {
 	suite.Run(t, new(HandlersTestSuite))
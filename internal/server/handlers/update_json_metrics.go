@@ -12,7 +12,10 @@ import (
 	"github.com/atrian/devmetrics/internal/dto"
 )
 
-// UpdateJSONMetrics обновление метрик POST /updates/ в JSON
+// UpdateJSONMetrics обновление метрик POST /updates/ в JSON.
+// Метрики агента, передавшего заголовок X-Agent-ID, хранятся отдельно от метрик других агентов.
+// Если установлен ключ подписи, идентификация агента проверяется по заголовку X-Agent-Signature.
+// Gauge метрики пакета, собранного по X-Collected-At раньше уже сохраненного пакета агента, не перезаписываются
 //
 //	@Tags Metrics
 //	@Summary Массовое обновление данных метрик с передачей данных в JSON формате
@@ -21,11 +24,25 @@ import (
 //	@Param metrics body []dto.Metrics true "Принимает JSON массивом метрик, возвращает JSON с обновленными данными"
 //	@Success 200 {array} dto.Metrics
 //	@Failure 400 {string} string ""
+//	@Failure 403 {string} string "Неверная подпись агента"
 //	@Failure 404 {string} string ""
 //	@Failure 500 {string} string ""
 //	@Router /updates/ [post]
 func (h *Handler) UpdateJSONMetrics() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		source := dto.Source{
+			AgentID:     r.Header.Get(dto.AgentIDHeader),
+			Labels:      dto.ParseLabels(r.Header.Get(dto.AgentLabelsHeader)),
+			CollectedAt: dto.ParseCollectedAt(r.Header.Get(dto.CollectedAtHeader)),
+		}
+		// чужой идентификатор без подписи не позволяет записать метрики от имени другого агента
+		if h.config.Server.HashKey != "" && source.AgentID != "" &&
+			!h.hasher.Compare(r.Header.Get(dto.AgentSignatureHeader), source.SignedData(), h.config.Server.HashKey) {
+			h.logger.Warning(fmt.Sprintf("UpdateJSONMetrics invalid signature of agent %v", source.AgentID))
+			http.Error(w, "Invalid agent signature", http.StatusForbidden)
+			return
+		}
+
 		// список уникальных метрик в запросе
 		countersRequested := make(map[string]int)
 		gaugesRequested := make(map[string]int)
@@ -61,15 +78,15 @@ func (h *Handler) UpdateJSONMetrics() http.HandlerFunc {
 			verifiedMetrics = append(verifiedMetrics, metric)
 		}
 
-		// сохраняем метрики с правильными подписями в БД
-		h.storage.SetMetrics(verifiedMetrics)
+		// сохраняем метрики с правильными подписями в БД отдельно для каждого агента
+		h.storage.SetSourceMetrics(source, verifiedMetrics)
 
 		// слайс уникальных метрик для ответа с актуальными значениями
 		responseMetrics := make([]dto.Metrics, 0, len(countersRequested)+len(gaugesRequested))
 
 		// собираем актуальные значения counters
 		for key := range countersRequested {
-			actualCounterValue, _ := h.storage.GetCounter(key)
+			actualCounterValue, _ := h.storage.GetSourceCounter(source.AgentID, key)
 
 			metric := dto.Metrics{
 				ID:    key,
@@ -88,7 +105,7 @@ func (h *Handler) UpdateJSONMetrics() http.HandlerFunc {
 
 		// собираем актуальные значения gauges
 		for key := range gaugesRequested {
-			actualGaugeValue, _ := h.storage.GetGauge(key)
+			actualGaugeValue, _ := h.storage.GetSourceGauge(source.AgentID, key)
 
 			metric := dto.Metrics{
 				ID:    key,
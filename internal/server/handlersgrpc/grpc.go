@@ -2,6 +2,7 @@ package handlersgrpc
 
 import (
 	"github.com/atrian/devmetrics/internal/server/storage"
+	"github.com/atrian/devmetrics/internal/signature"
 	"github.com/atrian/devmetrics/pkg/logger"
 	pb "github.com/atrian/devmetrics/proto"
 )
@@ -10,13 +11,17 @@ type MetricServer struct {
 	// pb.UnimplementedDevMetricsServer для совместимости с будущими версиями
 	pb.UnimplementedDevMetricsServer
 	storage storage.Repository
+	hashKey string           // hashKey ключ проверки подписи идентификации агента, пустой - не проверяется
+	hasher  signature.Hasher // hasher для проверки подписи
 	logger  logger.Logger
 }
 
-func NewMetricServer(storage storage.Repository, logger logger.Logger) *MetricServer {
+func NewMetricServer(storage storage.Repository, hashKey string, logger logger.Logger) *MetricServer {
 	ms := MetricServer{
 		UnimplementedDevMetricsServer: pb.UnimplementedDevMetricsServer{},
 		storage:                       storage,
+		hashKey:                       hashKey,
+		hasher:                        signature.NewSha256Hasher(),
 		logger:                        logger,
 	}
 
@@ -5,15 +5,25 @@ import (
 	"fmt"
 
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
 	"github.com/atrian/devmetrics/internal/dto"
 	pb "github.com/atrian/devmetrics/proto"
 )
 
+// UpdateMetrics массовое обновление метрик. Метрики агента, передавшего в метаданных x-agent-id,
+// хранятся отдельно от метрик других агентов. Если установлен ключ подписи,
+// идентификация агента проверяется по x-agent-signature. Gauge метрики пакета, собранного по x-collected-at
+// раньше уже сохраненного пакета агента, не перезаписываются
 func (ms *MetricServer) UpdateMetrics(ctx context.Context, in *pb.UpsertMetricsRequest) (*pb.UpsertMetricsResponse, error) {
 	var response pb.UpsertMetricsResponse
 
+	source, sign := sourceFromContext(ctx)
+	if ms.hashKey != "" && source.AgentID != "" && !ms.hasher.Compare(sign, source.SignedData(), ms.hashKey) {
+		return nil, status.Errorf(codes.PermissionDenied, "Invalid agent signature")
+	}
+
 	metricsSize := len(in.Metrics)
 	if metricsSize == 0 {
 		return nil, status.Errorf(codes.DataLoss, "Empty request")
@@ -43,7 +53,28 @@ func (ms *MetricServer) UpdateMetrics(ctx context.Context, in *pb.UpsertMetricsR
 		}
 	}
 
-	ms.storage.SetMetrics(metrics)
+	ms.storage.SetSourceMetrics(source, metrics)
 	response.Status = pb.UpsertMetricsResponse_OK
 	return &response, nil
 }
+
+// sourceFromContext идентификация агента, время сбора пакета и подпись из метаданных запроса
+func sourceFromContext(ctx context.Context) (source dto.Source, sign string) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return source, ""
+	}
+	if values := md.Get(dto.AgentIDHeader); len(values) > 0 {
+		source.AgentID = values[0]
+	}
+	if values := md.Get(dto.AgentLabelsHeader); len(values) > 0 {
+		source.Labels = dto.ParseLabels(values[0])
+	}
+	if values := md.Get(dto.CollectedAtHeader); len(values) > 0 {
+		source.CollectedAt = dto.ParseCollectedAt(values[0])
+	}
+	if values := md.Get(dto.AgentSignatureHeader); len(values) > 0 {
+		sign = values[0]
+	}
+	return source, sign
+}
@@ -68,6 +68,9 @@ func (r *Router) RegisterRoutes(handler *handlers.Handler) *Router {
 	// Пинг соединения с БД
 	r.Get("/ping", handler.GetPing())
 
+	// Проверка доступности сервера, не зависит от хранилища
+	r.Get("/healthz", handler.GetHealthz())
+
 	return r
 }
 
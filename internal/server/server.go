@@ -10,6 +10,8 @@ import (
 	"errors"
 	"fmt"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"net"
 	"net/http"
 
@@ -111,8 +113,10 @@ func (s *Server) runGRPCServer(ctx context.Context) {
 	// создаём gRPC-сервер без зарегистрированной службы
 	s.grpc = grpc.NewServer()
 	// регистрируем сервис
-	ms := handlersgrpc.NewMetricServer(s.storage, s.logger)
+	ms := handlersgrpc.NewMetricServer(s.storage, s.config.Server.HashKey, s.logger)
 	pb.RegisterDevMetricsServer(s.grpc, ms)
+	// регистрируем стандартный сервис проверки доступности, используется агентами для выбора сервера
+	healthpb.RegisterHealthServer(s.grpc, health.NewServer())
 
 	s.logger.Info("GRPC server started")
 
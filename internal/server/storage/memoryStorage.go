@@ -13,10 +13,9 @@ import (
 
 // MemoryStorage In Memory хранилище для метрик
 type MemoryStorage struct {
-	metrics     *MetricsDicts
-	config      *serverconfig.Config
-	logger      logger.Logger
-	silentStore bool
+	metrics *MetricsDicts
+	config  *serverconfig.Config
+	logger  logger.Logger
 }
 
 var _ Repository = (*MemoryStorage)(nil)
@@ -32,15 +31,13 @@ func NewMemoryStorage(config *serverconfig.Config, logger logger.Logger) *Memory
 }
 
 // StoreGauge сохранение метрики в In Memory хранилище
-// если s.silentStore == false будет произведен дамп в файл
+// при синхронной записи (StoreInterval = 0) будет произведен дамп в файл
 func (s *MemoryStorage) StoreGauge(name string, value float64) error {
 	s.metrics.GaugeDict[name] = gauge(value)
-	if !s.silentStore {
-		err := s.syncWithFileOnUpdate()
-		if err != nil {
-			s.logger.Error("StoreGauge syncWithFileOnUpdate", err)
-			return err
-		}
+	err := s.syncWithFileOnUpdate()
+	if err != nil {
+		s.logger.Error("StoreGauge syncWithFileOnUpdate", err)
+		return err
 	}
 	return nil
 }
@@ -53,15 +50,13 @@ func (s *MemoryStorage) GetGauge(name string) (float64, bool) {
 }
 
 // StoreCounter сохранение счетчика в In Memory хранилище
-// если s.silentStore == false будет произведен дамп в файл
+// при синхронной записи (StoreInterval = 0) будет произведен дамп в файл
 func (s *MemoryStorage) StoreCounter(name string, value int64) error {
 	s.metrics.CounterDict[name] += counter(value)
-	if !s.silentStore {
-		err := s.syncWithFileOnUpdate()
-		if err != nil {
-			s.logger.Error("StoreCounter syncWithFileOnUpdate", err)
-			return err
-		}
+	err := s.syncWithFileOnUpdate()
+	if err != nil {
+		s.logger.Error("StoreCounter syncWithFileOnUpdate", err)
+		return err
 	}
 	return nil
 }
@@ -102,28 +97,10 @@ func (s *MemoryStorage) DumpToFile(filename string) error {
 
 	metricsDTO := make([]dto.Metrics, 0, len(s.metrics.GaugeDict)+len(s.metrics.GaugeDict))
 
-	// собираем gauge метрики в общий слайс с метриками
-	for key, metric := range s.metrics.GaugeDict {
-		floatVal := float64(metric)
-		metricDTO := dto.Metrics{
-			ID:    key,
-			MType: "gauge",
-			Delta: nil,
-			Value: &floatVal,
-		}
-		metricsDTO = append(metricsDTO, metricDTO)
-	}
-
-	// собираем counter метрики в общий слайс с метриками
-	for key, metric := range s.metrics.CounterDict {
-		intVal := int64(metric)
-		metricDTO := dto.Metrics{
-			ID:    key,
-			MType: "counter",
-			Delta: &intVal,
-			Value: nil,
-		}
-		metricsDTO = append(metricsDTO, metricDTO)
+	// собираем общие метрики и метрики агентов в общий слайс, метки агентов в дамп не попадают
+	metricsDTO = appendDumpMetrics(metricsDTO, "", s.metrics.GaugeDict, s.metrics.CounterDict)
+	for source, sourceMetrics := range s.metrics.Sources {
+		metricsDTO = appendDumpMetrics(metricsDTO, source, sourceMetrics.GaugeDict, sourceMetrics.CounterDict)
 	}
 
 	// пишем все метрики в JSON
@@ -135,6 +112,33 @@ func (s *MemoryStorage) DumpToFile(filename string) error {
 	return nil
 }
 
+// appendDumpMetrics добавляет метрики источника source в слайс для дампа
+func appendDumpMetrics(metricsDTO []dto.Metrics, source string, gauges map[string]gauge, counters map[string]counter) []dto.Metrics {
+	// собираем gauge метрики в общий слайс с метриками
+	for key, metric := range gauges {
+		floatVal := float64(metric)
+		metricsDTO = append(metricsDTO, dto.Metrics{
+			ID:     key,
+			MType:  "gauge",
+			Value:  &floatVal,
+			Source: source,
+		})
+	}
+
+	// собираем counter метрики в общий слайс с метриками
+	for key, metric := range counters {
+		intVal := int64(metric)
+		metricsDTO = append(metricsDTO, dto.Metrics{
+			ID:     key,
+			MType:  "counter",
+			Delta:  &intVal,
+			Source: source,
+		})
+	}
+
+	return metricsDTO
+}
+
 // RestoreFromFile Восстановление данных из дамп файла на диске
 func (s *MemoryStorage) RestoreFromFile(filename string) error {
 	s.logger.Info("Restore metrics from file")
@@ -159,26 +163,66 @@ func (s *MemoryStorage) RestoreFromFile(filename string) error {
 	return nil
 }
 
-// SetMetrics массовое обновление данных в хранилище из слайса с dto.Metrics
+// SetMetrics массовое обновление данных в хранилище из слайса с dto.Metrics.
+// Метрики с заполненным Source сохраняются в справочники этого агента
 func (s *MemoryStorage) SetMetrics(metrics []dto.Metrics) {
-	s.silentStore = true
-	for key, metricCandidate := range metrics {
-		_ = key
+	for _, metricCandidate := range metrics {
+		gauges, counters := s.metrics.dicts(metricCandidate.Source)
 		switch metricCandidate.MType {
 		case "gauge":
-			err := s.StoreGauge(metricCandidate.ID, *metricCandidate.Value)
-			if err != nil {
-				s.logger.Error("SetMetrics StoreGauge error", err)
-			}
+			gauges[metricCandidate.ID] = gauge(*metricCandidate.Value)
 		case "counter":
-			err := s.StoreCounter(metricCandidate.ID, *metricCandidate.Delta)
-			if err != nil {
-				s.logger.Error("SetMetrics StoreCounter error", err)
-			}
+			counters[metricCandidate.ID] += counter(*metricCandidate.Delta)
 		default:
 		}
 	}
-	s.silentStore = false
+}
+
+// SetSourceMetrics массовое обновление метрик агента source, метки агента заменяются метками из source.
+// Метрики также сохраняются в общие справочники для клиентов, запрашивающих метрики без агента.
+// Gauge метрики пакета, собранного раньше уже сохраненного пакета агента, не перезаписываются
+func (s *MemoryStorage) SetSourceMetrics(source dto.Source, metrics []dto.Metrics) {
+	if source.AgentID == "" {
+		s.SetMetrics(sourceMetrics(source, metrics, false))
+		return
+	}
+
+	s.metrics.dicts(source.AgentID)
+	state := s.metrics.Sources[source.AgentID]
+	s.SetMetrics(sourceMetrics(source, metrics, staleBatch(source, state.CollectedAt)))
+
+	state.Labels = source.Labels
+	if source.CollectedAt.After(state.CollectedAt) {
+		state.CollectedAt = source.CollectedAt
+	}
+}
+
+// GetSourceGauge получение значения метрики агента source по имени
+// если метрики нет, вернется 0, false
+func (s *MemoryStorage) GetSourceGauge(source, name string) (float64, bool) {
+	if source == "" {
+		return s.GetGauge(name)
+	}
+	sourceMetrics, ok := s.metrics.Sources[source]
+	if !ok {
+		return 0, false
+	}
+	value, exist := sourceMetrics.GaugeDict[name]
+	return float64(value), exist
+}
+
+// GetSourceCounter получение значения счетчика агента source по имени
+// если счетчика нет, вернется 0, false
+func (s *MemoryStorage) GetSourceCounter(source, name string) (int64, bool) {
+	if source == "" {
+		return s.GetCounter(name)
+	}
+	sourceMetrics, ok := s.metrics.Sources[source]
+	if !ok {
+		return 0, false
+	}
+	value, exist := sourceMetrics.CounterDict[name]
+	return int64(value), exist
 }
 
 // syncWithFileOnUpdate сохраняем дамп метрик в файл при обновлении любой метрики если StoreInterval = 0
@@ -2,17 +2,80 @@
 // интерфейс Repository и 2 его реализации MemoryStorage и PgSQLStorage
 package storage
 
+import (
+	"time"
+
+	"github.com/atrian/devmetrics/internal/dto"
+)
+
 // MetricsDicts структура для хранения метрик и счетчиков
 type MetricsDicts struct {
 	GaugeDict   map[string]gauge
 	CounterDict map[string]counter
+	Sources     map[string]*SourceMetrics // Sources метрики агентов, передавших идентификатор, по AgentID
+}
+
+// SourceMetrics метрики и счетчики одного агента
+type SourceMetrics struct {
+	Labels      map[string]string // Labels статические метки агента из последнего пакета
+	CollectedAt time.Time         // CollectedAt время сбора самого нового сохраненного пакета агента
+	GaugeDict   map[string]gauge
+	CounterDict map[string]counter
 }
 
 func NewMetricsDicts() *MetricsDicts {
 	dict := MetricsDicts{
 		GaugeDict:   map[string]gauge{},
 		CounterDict: map[string]counter{},
+		Sources:     map[string]*SourceMetrics{},
 	}
 
 	return &dict
 }
+
+// dicts возвращает справочники метрик источника source, пустой source - общие справочники.
+// Справочники нового источника создаются при первом обращении
+func (md *MetricsDicts) dicts(source string) (map[string]gauge, map[string]counter) {
+	if source == "" {
+		return md.GaugeDict, md.CounterDict
+	}
+
+	sourceMetrics, ok := md.Sources[source]
+	if !ok {
+		sourceMetrics = &SourceMetrics{
+			GaugeDict:   map[string]gauge{},
+			CounterDict: map[string]counter{},
+		}
+		md.Sources[source] = sourceMetrics
+	}
+	return sourceMetrics.GaugeDict, sourceMetrics.CounterDict
+}
+
+// sourceMetrics метрики агента source для сохранения. Метрики агента с идентификатором
+// дублируются в общие справочники, чтобы они были доступны клиентам, не указывающим агента.
+// Gauge метрики устаревшего пакета (stale) пропускаются, чтобы не перезаписать более новые значения,
+// приращения счетчиков сохраняются всегда
+func sourceMetrics(source dto.Source, metrics []dto.Metrics, stale bool) []dto.Metrics {
+	result := make([]dto.Metrics, 0, 2*len(metrics))
+	for _, metric := range metrics {
+		if stale && metric.MType == "gauge" {
+			continue
+		}
+		metric.Source = source.AgentID
+		result = append(result, metric)
+	}
+	if source.AgentID == "" {
+		return result
+	}
+	for _, metric := range result[:len(result):len(result)] {
+		metric.Source = ""
+		result = append(result, metric)
+	}
+	return result
+}
+
+// staleBatch пакет агента source собран раньше самого нового сохраненного пакета этого агента, собранного в last.
+// Пакеты без идентификатора агента или без времени сбора устаревшими не считаются
+func staleBatch(source dto.Source, last time.Time) bool {
+	return source.AgentID != "" && !source.CollectedAt.IsZero() && source.CollectedAt.Before(last)
+}
@@ -2,11 +2,13 @@ package storage
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/atrian/devmetrics/internal/appconfig/serverconfig"
+	"github.com/atrian/devmetrics/internal/dto"
 	"github.com/atrian/devmetrics/pkg/logger"
 )
 
@@ -66,6 +68,61 @@ func (suite *HandlersTestSuite) TestStorage_StoreGauge() {
 	assert.Equal(suite.T(), float64(777), val)
 }
 
+func (suite *HandlersTestSuite) TestStorage_SetSourceMetrics() {
+	first, second := 1.0, 2.0
+	delta := int64(5)
+
+	suite.storage.SetSourceMetrics(dto.Source{AgentID: "web-1", Labels: map[string]string{"env": "prod"}},
+		[]dto.Metrics{{ID: "HeapAlloc", MType: "gauge", Value: &first}, {ID: "PollCount", MType: "counter", Delta: &delta}})
+	suite.storage.SetSourceMetrics(dto.Source{AgentID: "web-2"},
+		[]dto.Metrics{{ID: "HeapAlloc", MType: "gauge", Value: &second}, {ID: "PollCount", MType: "counter", Delta: &delta}})
+
+	// агенты не перезаписывают метрики друг друга
+	val, exist := suite.storage.GetSourceGauge("web-1", "HeapAlloc")
+	assert.True(suite.T(), exist)
+	assert.Equal(suite.T(), first, val)
+
+	val, _ = suite.storage.GetSourceGauge("web-2", "HeapAlloc")
+	assert.Equal(suite.T(), second, val)
+
+	counter, _ := suite.storage.GetSourceCounter("web-1", "PollCount")
+	assert.Equal(suite.T(), delta, counter)
+
+	// общие метрики содержат последнее значение gauge и сумму счетчиков всех агентов
+	val, exist = suite.storage.GetGauge("HeapAlloc")
+	assert.True(suite.T(), exist)
+	assert.Equal(suite.T(), second, val)
+
+	counter, _ = suite.storage.GetCounter("PollCount")
+	assert.Equal(suite.T(), 2*delta, counter)
+
+	assert.Equal(suite.T(), map[string]string{"env": "prod"}, suite.storage.GetMetrics().Sources["web-1"].Labels)
+}
+
+func (suite *HandlersTestSuite) TestStorage_SetSourceMetrics_Stale() {
+	collected := time.Date(2022, 12, 1, 10, 0, 0, 0, time.UTC)
+	source := dto.Source{AgentID: "stale-1", CollectedAt: collected}
+	fresh, stale := 2.0, 1.0
+	delta := int64(3)
+
+	suite.storage.SetSourceMetrics(source,
+		[]dto.Metrics{{ID: "StaleGauge", MType: "gauge", Value: &fresh}, {ID: "StaleCounter", MType: "counter", Delta: &delta}})
+
+	// пакет из очереди outbox агента собран раньше уже сохраненного
+	source.CollectedAt = collected.Add(-time.Minute)
+	suite.storage.SetSourceMetrics(source,
+		[]dto.Metrics{{ID: "StaleGauge", MType: "gauge", Value: &stale}, {ID: "StaleCounter", MType: "counter", Delta: &delta}})
+
+	// gauge не перезаписан более старым значением, приращение счетчика учтено
+	val, _ := suite.storage.GetSourceGauge("stale-1", "StaleGauge")
+	assert.Equal(suite.T(), fresh, val)
+	val, _ = suite.storage.GetGauge("StaleGauge")
+	assert.Equal(suite.T(), fresh, val)
+	counter, _ := suite.storage.GetSourceCounter("stale-1", "StaleCounter")
+	assert.Equal(suite.T(), 2*delta, counter)
+	assert.Equal(suite.T(), collected, suite.storage.GetMetrics().Sources["stale-1"].CollectedAt)
+}
+
 // Для запуска через Go test
 func TestHandlersTestSuite(t *testing.T) {
 	suite.Run(t, new(HandlersTestSuite))
@@ -3,6 +3,8 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -47,18 +49,19 @@ func NewPgSQLStorage(config *serverconfig.Config, logger logger.Logger) (*PgSQLS
 	}, nil
 }
 
-// upsertMetricQuery порядок аргументов в запросе: id, type, delta, value
+// upsertMetricQuery порядок аргументов в запросе: source, id, type, delta, value.
+// Пустой source - общие метрики без источника
 func upsertMetricQuery() string {
 	return `
-		INSERT INTO public.metrics (id, type, delta, value)
-		VALUES ($1, $2, $3, $4)
-		ON CONFLICT (id, type) DO UPDATE
-		SET type = $2, delta = $3, value = $4;`
+		INSERT INTO public.metrics (source, id, type, delta, value)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (source, id, type) DO UPDATE
+		SET delta = $4, value = $5;`
 }
 
 // StoreGauge сохранение метрики в БД
 func (s *PgSQLStorage) StoreGauge(name string, value float64) error {
-	_, err := s.pgPool.Exec(context.Background(), upsertMetricQuery(), name, "gauge", nil, value)
+	_, err := s.pgPool.Exec(context.Background(), upsertMetricQuery(), "", name, "gauge", nil, value)
 	if err != nil {
 		s.logger.Error("StoreGauge pgPool.Exec", err)
 		return fmt.Errorf(`failed store gauge: %w`, err)
@@ -74,8 +77,8 @@ func (s *PgSQLStorage) StoreCounter(name string, value int64) error {
 		value += storedCounter
 	}
 
-	// Порядок аргументов id, type, delta, value
-	_, err := s.pgPool.Exec(context.Background(), upsertMetricQuery(), name, "counter", value, nil)
+	// Порядок аргументов source, id, type, delta, value
+	_, err := s.pgPool.Exec(context.Background(), upsertMetricQuery(), "", name, "counter", value, nil)
 	if err != nil {
 		s.logger.Error("StoreCounter pgPool.Exec", err)
 		return fmt.Errorf(`failed store counter: %w`, err)
@@ -86,10 +89,15 @@ func (s *PgSQLStorage) StoreCounter(name string, value int64) error {
 
 // GetGauge получение метрики по имени
 func (s *PgSQLStorage) GetGauge(name string) (float64, bool) {
+	return s.GetSourceGauge("", name)
+}
+
+// GetSourceGauge получение метрики агента source по имени
+func (s *PgSQLStorage) GetSourceGauge(source, name string) (float64, bool) {
 	var value float64
 
-	sqlQuery := `SELECT value FROM public.metrics WHERE id=$1 AND type='gauge';`
-	row := s.pgPool.QueryRow(context.Background(), sqlQuery, name)
+	sqlQuery := `SELECT value FROM public.metrics WHERE source=$1 AND id=$2 AND type='gauge';`
+	row := s.pgPool.QueryRow(context.Background(), sqlQuery, source, name)
 
 	switch err := row.Scan(&value); err {
 	case nil:
@@ -102,10 +110,15 @@ func (s *PgSQLStorage) GetGauge(name string) (float64, bool) {
 
 // GetCounter получение счетчика по имени
 func (s *PgSQLStorage) GetCounter(name string) (int64, bool) {
+	return s.GetSourceCounter("", name)
+}
+
+// GetSourceCounter получение счетчика агента source по имени
+func (s *PgSQLStorage) GetSourceCounter(source, name string) (int64, bool) {
 	var delta int64
 
-	sqlQuery := `SELECT delta FROM public.metrics WHERE id=$1 AND type='counter';`
-	row := s.pgPool.QueryRow(context.Background(), sqlQuery, name)
+	sqlQuery := `SELECT delta FROM public.metrics WHERE source=$1 AND id=$2 AND type='counter';`
+	row := s.pgPool.QueryRow(context.Background(), sqlQuery, source, name)
 
 	switch err := row.Scan(&delta); err {
 	case nil:
@@ -119,13 +132,14 @@ func (s *PgSQLStorage) GetCounter(name string) (int64, bool) {
 // GetMetrics получение всех метрик и счетчиков из БД в структуре MetricsDicts
 func (s *PgSQLStorage) GetMetrics() *MetricsDicts {
 	var (
+		source     string
 		metricID   string
 		metricType string
 		value      sql.NullFloat64
 		delta      sql.NullInt64
 	)
 
-	sqlStatement := `SELECT id, type, delta, value FROM public.metrics;`
+	sqlStatement := `SELECT source, id, type, delta, value FROM public.metrics;`
 	rows, err := s.pgPool.Query(context.Background(), sqlStatement)
 
 	if err != nil {
@@ -135,28 +149,32 @@ func (s *PgSQLStorage) GetMetrics() *MetricsDicts {
 	defer rows.Close()
 
 	for rows.Next() {
-		err = rows.Scan(&metricID, &metricType, &delta, &value)
+		err = rows.Scan(&source, &metricID, &metricType, &delta, &value)
 		if err != nil {
 			s.logger.Error("GetMetrics rows.Scan", err)
 			continue
 		}
 
+		gauges, counters := s.metrics.dicts(source)
 		switch metricType {
 		case "gauge":
-			s.metrics.GaugeDict[metricID] = gauge(value.Float64)
+			gauges[metricID] = gauge(value.Float64)
 		case "counter":
-			s.metrics.CounterDict[metricID] = counter(delta.Int64)
+			counters[metricID] = counter(delta.Int64)
 		default:
 			continue
 		}
 	}
 
+	s.loadSourceLabels()
+
 	return s.metrics
 }
 
 // SetMetrics сохранение слайса DTO Metrics в бд.
 func (s *PgSQLStorage) SetMetrics(metrics []dto.Metrics) {
-	memoryCounters := make(map[string]int64)
+	// ключ - источник и имя счетчика
+	memoryCounters := make(map[[2]string]int64)
 	ctx := context.Background()
 
 	// начинаем транзакцию
@@ -169,23 +187,24 @@ func (s *PgSQLStorage) SetMetrics(metrics []dto.Metrics) {
 	for _, metric := range metrics {
 		switch metric.MType {
 		case "counter":
+			key := [2]string{metric.Source, metric.ID}
 			// получаем сохраненное ранее в БД значение
-			storedCounter, _ := s.GetCounter(metric.ID)
+			storedCounter, _ := s.GetSourceCounter(metric.Source, metric.ID)
 			// получаем сохраненное ранее значение в памяти в рамках одного batch запроса
-			memoryCounter := memoryCounters[metric.ID]
+			memoryCounter := memoryCounters[key]
 
 			s.logger.Debug(fmt.Sprintf("SetMetrics counter value update: storedCounter %v, memoryCounter: %v, *metric.Delta: %v, position sum: %v",
 				storedCounter, memoryCounter, *metric.Delta, storedCounter+memoryCounter+*metric.Delta))
 
-			batch.Queue(upsertMetricQuery(), metric.ID, metric.MType, *metric.Delta+storedCounter+memoryCounter, nil)
+			batch.Queue(upsertMetricQuery(), metric.Source, metric.ID, metric.MType, *metric.Delta+storedCounter+memoryCounter, nil)
 			// обновляем сумму в памяти
-			memoryCounters[metric.ID] += *metric.Delta
+			memoryCounters[key] += *metric.Delta
 		case "gauge":
 
 			s.logger.Debug(fmt.Sprintf("SetMetrics gauge value update: %v", *metric.Value))
 
 			// записываем последнее если пришла пачка одинаковых
-			batch.Queue(upsertMetricQuery(), metric.ID, metric.MType, nil, *metric.Value)
+			batch.Queue(upsertMetricQuery(), metric.Source, metric.ID, metric.MType, nil, *metric.Value)
 		default:
 			continue
 		}
@@ -204,6 +223,71 @@ func (s *PgSQLStorage) SetMetrics(metrics []dto.Metrics) {
 	}
 }
 
+// SetSourceMetrics сохранение метрик агента source в бд, метки агента заменяются метками из source.
+// Метрики также сохраняются в общие справочники для клиентов, запрашивающих метрики без агента.
+// Gauge метрики пакета, собранного раньше уже сохраненного пакета агента, не перезаписываются
+func (s *PgSQLStorage) SetSourceMetrics(source dto.Source, metrics []dto.Metrics) {
+	if source.AgentID == "" {
+		s.SetMetrics(sourceMetrics(source, metrics, false))
+		return
+	}
+
+	var last sql.NullTime
+	err := s.pgPool.QueryRow(context.Background(),
+		`SELECT collected_at FROM public.sources WHERE id = $1;`, source.AgentID).Scan(&last)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("SetSourceMetrics load collected_at", err)
+	}
+
+	labels, err := json.Marshal(source.Labels)
+	if err != nil {
+		s.logger.Error("SetSourceMetrics json.Marshal labels", err)
+		labels = []byte("{}")
+	}
+
+	// GREATEST пропускает NULL, поэтому пакет без времени сбора не сбрасывает сохраненное время
+	collectedAt := sql.NullTime{Time: source.CollectedAt, Valid: !source.CollectedAt.IsZero()}
+	_, err = s.pgPool.Exec(context.Background(), `
+		INSERT INTO public.sources (id, labels, collected_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE
+		SET labels = $2, collected_at = GREATEST(public.sources.collected_at, $3);`,
+		source.AgentID, string(labels), collectedAt)
+	if err != nil {
+		s.logger.Error("SetSourceMetrics store labels", err)
+	}
+
+	s.SetMetrics(sourceMetrics(source, metrics, last.Valid && staleBatch(source, last.Time)))
+}
+
+// loadSourceLabels загрузка меток агентов в s.metrics
+func (s *PgSQLStorage) loadSourceLabels() {
+	rows, err := s.pgPool.Query(context.Background(), `SELECT id, labels FROM public.sources;`)
+	if err != nil {
+		s.logger.Error("loadSourceLabels pgPool.Query", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			source string
+			labels []byte
+		)
+		if err = rows.Scan(&source, &labels); err != nil {
+			s.logger.Error("loadSourceLabels rows.Scan", err)
+			continue
+		}
+
+		s.metrics.dicts(source)
+		sourceLabels := map[string]string{}
+		if err = json.Unmarshal(labels, &sourceLabels); err != nil {
+			s.logger.Error("loadSourceLabels json.Unmarshal", err)
+		}
+		s.metrics.Sources[source].Labels = sourceLabels
+	}
+}
+
 // RunOnStart на старте запускаем миграции, запускаем тикер статистики пула соединений с бд
 func (s *PgSQLStorage) RunOnStart() {
 	s.runMigrations(s.config.Server.DBDSN)
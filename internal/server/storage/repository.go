@@ -14,6 +14,10 @@ type Repository interface {
 	StoreCounter(name string, value int64) error // StoreCounter запись счетчика
 	GetCounter(name string) (int64, bool)        // GetCounter получение значения счетчика по имени
 	GetMetrics() *MetricsDicts                   // GetMetrics получение всего справочника метрик MetricsDicts
-	SetMetrics(metrics []dto.Metrics)            // SetMetrics массовое сохранение метрик из слайса dto.Metrics
+	SetMetrics(metrics []dto.Metrics)            // SetMetrics массовое сохранение метрик из слайса dto.Metrics с учетом dto.Metrics.Source
+	// SetSourceMetrics массовое сохранение метрик агента source отдельно от метрик других агентов
+	SetSourceMetrics(source dto.Source, metrics []dto.Metrics)
+	GetSourceGauge(source, name string) (float64, bool) // GetSourceGauge получение значения метрики агента source по имени
+	GetSourceCounter(source, name string) (int64, bool) // GetSourceCounter получение значения счетчика агента source по имени
 	Observer
 }